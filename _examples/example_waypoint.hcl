@@ -24,6 +24,17 @@ app "db" {
         use "dockerdesk" {
             published_ports = "5432:5432"
             use_app_as_container_name = true
+
+            # Let postgres shut down cleanly before it is killed
+            stop_signal  = "SIGINT"
+            stop_timeout = "30s"
+
+            healthcheck {
+                test     = ["pg_isready -U postgres"]
+                interval = "5s"
+                timeout  = "3s"
+                retries  = 5
+            }
         }
     }
 }
@@ -38,6 +49,7 @@ app "backend" {
     deploy {
         use "dockerdesk" {
             binds = ["${path.app}:/workspace:cached"]
+            working_dir = "/workspace"
             service_port = 80
             use_app_as_container_name = true
         }
@@ -56,6 +68,17 @@ app "frontend" {
             published_ports = "80:80"
             service_port = 80
             use_app_as_container_name = true
+
+            readiness {
+                probe   = "http"
+                timeout = "30s"
+            }
+        }
+    }
+
+    release {
+        use "dockerdesk" {
+            port = 8080
         }
     }
 }
\ No newline at end of file
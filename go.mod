@@ -8,6 +8,7 @@ require (
 )
 
 require (
+	github.com/docker/cli v20.10.7+incompatible
 	github.com/docker/distribution v2.7.1+incompatible
 	github.com/docker/docker v20.10.12+incompatible
 	github.com/docker/go-connections v0.4.0
@@ -17,4 +18,6 @@ require (
 	google.golang.org/grpc v1.39.1
 )
 
+require github.com/docker/docker-credential-helpers v0.6.3 // indirect
+
 // replace github.com/hashicorp/waypoint-plugin-sdk => ../../waypoint-plugin-sdk
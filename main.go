@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/1xyz/dockerdesk/platform"
+	"github.com/1xyz/dockerdesk/release"
 	sdk "github.com/hashicorp/waypoint-plugin-sdk"
 )
 
@@ -16,6 +17,6 @@ func main() {
 		//&builder.Builder{},
 		//&registry.Registry{},
 		&platform.Platform{},
-		//&release.ReleaseManager{},
+		&release.ReleaseManager{},
 	))
 }
@@ -3,7 +3,11 @@ package platform
 
 // PlatformConfig is the configuration structure for the Platform.
 type PlatformConfig struct {
-	// A list of folders to mount to the container.
+	// Credentials for pulling the image from a private registry.
+	Auth *AuthConfig `hcl:"auth,block"`
+
+	// A list of folders to mount to the container, in the docker form
+	// <src>:<dst>[:<opts>]. The mount blocks can express more.
 	Binds []string `hcl:"binds,optional"`
 
 	// ClientConfig allow the user to specify the connection to the Docker
@@ -19,26 +23,93 @@ type PlatformConfig struct {
 	// a shell. If you want to use a shell, add that to this command manually.
 	Command []string `hcl:"command,optional"`
 
-	// Force pull the image from the remote repository
+	// Domain name of the container.
+	Domainname string `hcl:"domainname,optional"`
+
+	// Overrides the ENTRYPOINT of the image. The command is passed to it
+	// as arguments.
+	Entrypoint []string `hcl:"entrypoint,optional"`
+
+	// Force pull the image from the remote repository. Same as pull_policy
+	// "always".
 	ForcePull bool `hcl:"force_pull,optional"`
 
+	// Host name of the container. Defaults to the container id.
+	Hostname string `hcl:"hostname,optional"`
+
+	// Healthcheck configures how docker checks the health of the container.
+	// It overrides the HEALTHCHECK defined by the image, and can disable it.
+	Healthcheck *HealthcheckConfig `hcl:"healthcheck,block"`
+
 	// A map of key/value pairs, stored in docker as a string. Each key/value pair must
 	// be unique. Validiation occurs at the docker layer, not in Waypoint. Label
 	// keys are alphanumeric strings which may contain periods (.) and hyphens (-).
 	// See the docker docs for more info: https://docs.docker.com/config/labels-custom-metadata/
 	Labels map[string]string `hcl:"labels,optional"`
 
+	// Bind mounts, volumes and tmpfs mounts of the container. Relative host
+	// paths are resolved against the app path and must exist, which is
+	// checked up front when the daemon is local.
+	Mounts []*MountConfig `hcl:"mount,block"`
+
+	// The network the container is attached to and reachable under its app
+	// name. Defaults to a bridge network called "waypoint" that is shared
+	// by all apps.
+	Network *NetworkConfig `hcl:"network,block"`
+
+	// Settings for additional networks the container is connected to, such
+	// as a static address or extra aliases. The network does not need to be
+	// listed in networks as well.
+	NetworkAttachments []*NetworkAttachmentConfig `hcl:"network_attachment,block"`
+
 	// An array of strings with network names to connect the container to
 	Networks []string `hcl:"networks,optional"`
 
 	// A map of resources to configure the container with such as memory and cpu
-	// limits.
+	// limits. All keys are optional:
+	// - memory, memory_reservation: human sizes such as "512MB"
+	// - memory_swap: memory plus swap as a human size, or "-1" for unlimited
+	// - cpu: relative CPU shares, e.g. "512"
+	// - nano_cpus: the number of CPUs, e.g. "1.5"
+	// - cpuset_cpus: the CPUs the container may use, e.g. "0-3,6"
+	// - pids_limit: the maximum number of processes
+	// - blkio_weight: relative block IO weight between 10 and 1000
+	// - ulimit_<name>: "<soft>[:<hard>]", e.g. ulimit_nofile = "1024:2048"
 	Resources map[string]string `hcl:"resources,optional"`
 
+	// When docker restarts the container: "no", "on-failure" with an
+	// optional maximum retry count such as "on-failure:5", "unless-stopped"
+	// or "always". Defaults to no.
+	RestartPolicy string `hcl:"restart_policy,optional"`
+
+	// Keep the previous container, stopped, until the new one serves under
+	// the app name during a redeploy with use_app_as_container_name. If the
+	// new container fails to start or become ready at that point, the
+	// previous container is restarted and keeps serving.
+	RollbackOnFailure bool `hcl:"rollback_on_failure,optional"`
+
 	// A path to a directory that will be created for the service to store
-	// temporary data.
+	// temporary data. Defaults to /input.
 	ScratchSpace string `hcl:"scratch_path,optional"`
 
+	// What backs the scratch directory: "volume" for the <app>-scratch
+	// volume that is shared between deployments, "tmpfs" for memory that is
+	// thrown away with the container, or "none" to not mount it at all.
+	// Defaults to volume.
+	ScratchType string `hcl:"scratch_type,optional"`
+
+	// Size limit of a tmpfs scratch directory, e.g. "64m". Defaults to no
+	// limit.
+	ScratchSize string `hcl:"scratch_size,optional"`
+
+	// The signal sent to stop the container, e.g. "SIGINT". Defaults to the
+	// STOPSIGNAL of the image, or SIGTERM.
+	StopSignal string `hcl:"stop_signal,optional"`
+
+	// How long the container gets to stop after the stop signal before it
+	// is killed, e.g. "30s". Defaults to 10s.
+	StopTimeout string `hcl:"stop_timeout,optional"`
+
 	// Environment variables that are meant to configure the application in a static
 	// way. This might be control an image that has mulitple modes of operation,
 	// selected via environment variable. Most configuration should use the waypoint
@@ -54,15 +125,256 @@ type PlatformConfig struct {
 	// or default to another port.
 	ServicePort uint `hcl:"service_port,optional"`
 
+	// When to pull the image: "always", "if-not-present" when it is not in
+	// the local cache, "if-changed" when the registry has a different
+	// digest for the tag than the cached image, or "never". Defaults to
+	// if-not-present.
+	PullPolicy string `hcl:"pull_policy,optional"`
+
+	// How long pulling the image may take, e.g. "5m". Defaults to 10m.
+	PullTimeout string `hcl:"pull_timeout,optional"`
+
+	// Ports to publish on the host. Each port block maps a container port
+	// or range of ports to the host, and is validated when the config is
+	// loaded. Can be combined with published_ports.
+	Ports []*PortConfig `hcl:"port,block"`
+
+	// Ports to publish in the form of docker run -p:
+	// [<host-ip>:][<host-port>:]<container-port>[/<proto>], where the host
+	// port comes first, host-port may be empty, IPv6 addresses are written
+	// in brackets and ports can be ranges.
+	// Example: ["127.0.0.1:5433:5432", "8080:80", "30000-30010:30000-30010"]
+	// Can be combined with published_ports and the port blocks.
+	Publish []string `hcl:"publish,optional"`
+
 	// PublishedPorts is a CSV of docker ports published
 	// - Each entry is of the form <container-port>:<host=port>/<proto>
 	//   where host-port and proto are optional
+	// - Note the container port comes first, the reverse of publish
+	// - Ports can be ranges, e.g. 8000-8010:8000-8010
 	// - Example: 3000:3001/tcp, 8080:80
 	// See: https://docs.docker.com/config/containers/container-networking/#published-ports
+	// The port blocks can express more, this form is kept for existing configs.
 	PublishedPorts string `hcl:"published_ports,optional"`
 
-	// Set the container name to the app name
+	// Readiness makes the deploy wait for the container to be ready before
+	// it is reported as deployed. Without this block the deploy finishes as
+	// soon as the container has started.
+	Readiness *ReadinessConfig `hcl:"readiness,block"`
+
+	// Named volumes to create and mount into the container. Volumes are
+	// created before the container and kept when the deployment is destroyed,
+	// unless on_destroy is "remove".
+	Volumes []*VolumeConfig `hcl:"volume,block"`
+
+	// The user the container runs as, as a name or uid, with an optional
+	// group, e.g. "1000:1000" to match the owner of bind mounted files.
+	// Defaults to the USER of the image.
+	User string `hcl:"user,optional"`
+
+	// Set the container name to the app name. A redeploy starts the new
+	// container under a temporary name next to the running one, and only
+	// replaces it once the new container is healthy.
 	UseAppAsContainerName bool `hcl:"use_app_as_container_name,optional"`
+
+	// The directory the command runs in. Defaults to the WORKDIR of the
+	// image.
+	WorkingDir string `hcl:"working_dir,optional"`
+}
+
+type AuthConfig struct {
+	// Username and password for the registry.
+	Username string `hcl:"username,optional"`
+	Password string `hcl:"password,optional"`
+
+	// Identity token for the registry, instead of a username and password.
+	IdentityToken string `hcl:"identity_token,optional"`
+
+	// Use the credentials stored for the registry by `docker login`, from
+	// the docker config file or its credential helpers.
+	DockerConfig bool `hcl:"docker_config,optional"`
+
+	// The registry the credentials are for. Defaults to the registry of
+	// the image.
+	ServerAddress string `hcl:"server_address,optional"`
+}
+
+type NetworkConfig struct {
+	// Name of the network. It is created if it doesn't exist yet.
+	// Defaults to "waypoint".
+	Name string `hcl:"name,optional"`
+
+	// Give each "project" or "workspace" its own network instead of the
+	// shared one. The network is named after the project (and workspace),
+	// labeled with both, and removed when the last deployment attached to
+	// it is destroyed.
+	Isolate string `hcl:"isolate,optional"`
+
+	// Network driver, defaults to bridge.
+	Driver string `hcl:"driver,optional"`
+
+	// Subnet in CIDR form, e.g. "172.28.0.0/16". Give projects that run
+	// side by side subnets that don't overlap. Defaults to one picked by docker.
+	Subnet string `hcl:"subnet,optional"`
+
+	// Gateway of the subnet, e.g. "172.28.0.1". Requires subnet.
+	Gateway string `hcl:"gateway,optional"`
+
+	// Enable IPv6 on the network.
+	IPv6 bool `hcl:"ipv6,optional"`
+
+	// Restrict the network to traffic between its containers, without
+	// access to the outside.
+	Internal bool `hcl:"internal,optional"`
+
+	// Options passed to the network driver.
+	DriverOpts map[string]string `hcl:"driver_opts,optional"`
+
+	// Static IPv4 address of the container on the network. Requires subnet.
+	IPv4Address string `hcl:"ipv4_address,optional"`
+
+	// Static IPv6 address of the container on the network. Requires ipv6.
+	IPv6Address string `hcl:"ipv6_address,optional"`
+
+	// DNS names the container is reachable under besides the app name.
+	Aliases []string `hcl:"aliases,optional"`
+
+	// Links to other containers, in the form "<container>[:<alias>]".
+	Links []string `hcl:"links,optional"`
+}
+
+type VolumeConfig struct {
+	// Name of the volume. It is created if it doesn't exist yet.
+	Name string `hcl:"name"`
+
+	// Volume driver, defaults to local.
+	Driver string `hcl:"driver,optional"`
+
+	// Options passed to the volume driver.
+	Options map[string]string `hcl:"options,optional"`
+
+	// Absolute path the volume is mounted at in the container.
+	Path string `hcl:"path"`
+
+	// Mount the volume read-only.
+	ReadOnly bool `hcl:"read_only,optional"`
+
+	// What happens to the volume when the deployment is destroyed, "retain"
+	// or "remove". Defaults to retain. Only a volume the deployment created
+	// is removed, one that existed before or is still used by another
+	// container is always retained.
+	OnDestroy string `hcl:"on_destroy,optional"`
+}
+
+type MountConfig struct {
+	// One of bind, volume or tmpfs.
+	Type string `hcl:"type"`
+
+	// The host path of a bind mount, or the name of a volume. Leave empty
+	// for an anonymous volume. Not used by tmpfs mounts.
+	Source string `hcl:"source,optional"`
+
+	// Absolute path the mount is placed at in the container.
+	Target string `hcl:"target"`
+
+	// Mount read-only.
+	ReadOnly bool `hcl:"read_only,optional"`
+
+	// One of consistent, cached, delegated or default. Only used by
+	// Docker Desktop for Mac.
+	Consistency string `hcl:"consistency,optional"`
+
+	// Propagation of a bind mount: private, rprivate, shared, rshared, slave
+	// or rslave.
+	Propagation string `hcl:"propagation,optional"`
+
+	// Size limit of a tmpfs mount, e.g. "64m". Defaults to no limit.
+	TmpfsSize string `hcl:"tmpfs_size,optional"`
+
+	// File mode of a tmpfs mount in octal, e.g. "1777".
+	TmpfsMode string `hcl:"tmpfs_mode,optional"`
+}
+
+type NetworkAttachmentConfig struct {
+	// Name of the network to connect the container to.
+	Name string `hcl:"name,label"`
+
+	// Static IPv4 address of the container on the network. The network
+	// must have a user configured subnet.
+	IPv4Address string `hcl:"ipv4_address,optional"`
+
+	// Static IPv6 address of the container on the network.
+	IPv6Address string `hcl:"ipv6_address,optional"`
+
+	// DNS names the container is reachable under on the network.
+	Aliases []string `hcl:"aliases,optional"`
+
+	// Links to other containers, in the form "<container>[:<alias>]".
+	Links []string `hcl:"links,optional"`
+}
+
+type PortConfig struct {
+	// Port inside the container, or a range of ports such as "8000-8010".
+	Container string `hcl:"container"`
+
+	// Port on the host, or a range of the same size as the container range.
+	// Leave empty for docker to pick a random port.
+	Host string `hcl:"host,optional"`
+
+	// One of tcp, udp or sctp. Defaults to tcp.
+	Protocol string `hcl:"protocol,optional"`
+
+	// Host IP to bind the port on, e.g. "127.0.0.1" to keep the port
+	// local to this machine. Defaults to all interfaces.
+	HostIP string `hcl:"host_ip,optional"`
+}
+
+type HealthcheckConfig struct {
+	// The command to run to check health. A list starting with CMD or
+	// CMD-SHELL is passed to docker as is. Otherwise a single string is run
+	// with the container's shell and a longer list is run directly.
+	// Leave empty to keep the image's command and only change the timings.
+	Test []string `hcl:"test,optional"`
+
+	// Time between two checks, e.g. "30s". Defaults to docker's 30s.
+	Interval string `hcl:"interval,optional"`
+
+	// Time after which a single check is considered failed, e.g. "5s".
+	// Defaults to docker's 30s.
+	Timeout string `hcl:"timeout,optional"`
+
+	// Number of consecutive failures before the container is unhealthy.
+	// Defaults to docker's 3.
+	Retries int `hcl:"retries,optional"`
+
+	// Grace period for the container to start, during which failures
+	// don't count towards retries, e.g. "10s".
+	StartPeriod string `hcl:"start_period,optional"`
+
+	// Disable turns off any health check defined by the image.
+	Disable bool `hcl:"disable,optional"`
+}
+
+type ReadinessConfig struct {
+	// How long to wait for the container to become ready, e.g. "90s".
+	// The deploy fails after that. Defaults to 60s.
+	Timeout string `hcl:"timeout,optional"`
+
+	// How to check containers that have no docker health check: "tcp"
+	// connects to the service_port on the container's address, or on the
+	// published port when the container isn't reachable from the plugin,
+	// "http" sends a GET request to the published service_port and
+	// expects a 2xx or 3xx response, "none" only checks that the container
+	// stays up. Containers with a health check are ready once docker
+	// reports them healthy. Defaults to tcp.
+	Probe string `hcl:"probe,optional"`
+
+	// The path requested by the http probe. Defaults to "/".
+	Path string `hcl:"path,optional"`
+
+	// Number of container log lines shown when the container does not
+	// become ready. Defaults to 20.
+	LogLines int `hcl:"log_lines,optional"`
 }
 
 type ClientConfig struct {
@@ -2,6 +2,10 @@ package platform
 
 import (
 	"context"
+	"fmt"
+	"path"
+
+	"github.com/docker/docker/api/types/container"
 	"github.com/hashicorp/waypoint/builtin/docker"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -24,6 +28,81 @@ func (p *Platform) Config() (interface{}, error) {
 	return &p.config, nil
 }
 
+// Implement ConfigurableNotify
+func (p *Platform) ConfigSet(config interface{}) error {
+	c, ok := config.(*PlatformConfig)
+	if !ok {
+		// The Waypoint SDK should ensure this never gets hit
+		return fmt.Errorf("expected *PlatformConfig as parameter")
+	}
+
+	if c.Auth != nil {
+		if err := c.Auth.validate(); err != nil {
+			return fmt.Errorf("invalid auth: %w", err)
+		}
+	}
+
+	if err := c.validatePull(); err != nil {
+		return err
+	}
+
+	if c.Network != nil {
+		if err := c.Network.validate(); err != nil {
+			return fmt.Errorf("invalid network: %w", err)
+		}
+	}
+
+	if err := c.validateNetworkAttachments(); err != nil {
+		return err
+	}
+
+	if err := c.validateVolumes(); err != nil {
+		return err
+	}
+
+	if err := c.validateScratch(); err != nil {
+		return fmt.Errorf("invalid scratch space: %w", err)
+	}
+
+	if err := c.validateMounts(); err != nil {
+		return err
+	}
+
+	if _, err := c.publishedPorts(); err != nil {
+		return err
+	}
+
+	if _, err := c.resources(); err != nil {
+		return fmt.Errorf("invalid resources: %w", err)
+	}
+
+	if c.WorkingDir != "" && !path.IsAbs(c.WorkingDir) {
+		return fmt.Errorf("working_dir must be absolute, got %q", c.WorkingDir)
+	}
+
+	if err := c.setStop(&container.Config{}); err != nil {
+		return err
+	}
+
+	if _, err := c.restartPolicy(); err != nil {
+		return fmt.Errorf("invalid restart_policy: %w", err)
+	}
+
+	if c.Healthcheck != nil {
+		if _, err := c.Healthcheck.healthConfig(); err != nil {
+			return fmt.Errorf("invalid healthcheck: %w", err)
+		}
+	}
+
+	if c.Readiness != nil {
+		if err := c.Readiness.validate(); err != nil {
+			return fmt.Errorf("invalid readiness: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // Implement Builder
 func (p *Platform) DeployFunc() interface{} {
 	// return a function which will be called by Waypoint
@@ -31,7 +31,7 @@ func (p *Platform) Destroy(
 		})
 	} else {
 		// Load our set state
-		if err := rm.LoadState(deployment.ResourceState); err != nil {
+		if err := loadState(rm, deployment.ResourceState); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,155 @@
+package platform
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint/builtin/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The command run by `waypoint exec` when no arguments are given
+var defaultExecCommand = []string{"/bin/sh"}
+
+// ExecFunc implements component.ExecPlatform
+func (p *Platform) ExecFunc() interface{} {
+	return p.Exec
+}
+
+// Exec runs the session's command in the deployment's container, wiring up
+// stdin, stdout and stderr, and forwards terminal resizes when the session
+// has a TTY. The exit code of the command is returned as the result.
+func (p *Platform) Exec(
+	ctx context.Context,
+	log hclog.Logger,
+	deployment *docker.Deployment,
+	es *component.ExecSessionInfo,
+) (*component.ExecResult, error) {
+	cli, err := p.getDockerClient(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to create Docker client: %s", err)
+	}
+
+	state, err := p.containerState(log, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := es.Arguments
+	if len(cmd) == 0 {
+		cmd = defaultExecCommand
+	}
+
+	env := es.Environment
+	if es.IsTTY && es.Term != "" {
+		env = append(env, "TERM="+es.Term)
+	}
+
+	log.Debug("creating exec session", "container", state.Id, "cmd", cmd, "tty", es.IsTTY)
+	ex, err := cli.ContainerExecCreate(ctx, state.Id, types.ExecConfig{
+		Cmd:          cmd,
+		Env:          env,
+		Tty:          es.IsTTY,
+		AttachStdin:  es.Input != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to create exec session in container %q: %s", state.Id, err)
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, ex.ID, types.ExecStartCheck{
+		Tty: es.IsTTY,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to attach to exec session: %s", err)
+	}
+	defer resp.Close()
+
+	if es.IsTTY {
+		resizeExec(ctx, log, cli, ex.ID, es.InitialWindowSize)
+
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ws, ok := <-es.WindowSizeUpdates:
+					if !ok {
+						return
+					}
+					resizeExec(ctx, log, cli, ex.ID, ws)
+				}
+			}
+		}()
+	}
+
+	if es.Input != nil {
+		go func() {
+			if _, err := io.Copy(resp.Conn, es.Input); err != nil {
+				log.Debug("error forwarding stdin to exec session", "err", err)
+			}
+			resp.CloseWrite()
+		}()
+	}
+
+	// With a TTY docker sends a single raw stream, otherwise stdout and
+	// stderr are multiplexed.
+	if es.IsTTY {
+		_, err = io.Copy(es.Output, resp.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(es.Output, es.Error, resp.Reader)
+	}
+	if err != nil && ctx.Err() == nil {
+		return nil, status.Errorf(codes.Internal, "error reading exec session output: %s", err)
+	}
+
+	exitCode, err := execExitCode(ctx, cli, ex.ID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to inspect exec session: %s", err)
+	}
+
+	return &component.ExecResult{ExitCode: exitCode}, nil
+}
+
+func resizeExec(ctx context.Context, log hclog.Logger, cli *client.Client, id string, ws component.WindowSize) {
+	if ws.Height <= 0 || ws.Width <= 0 {
+		return
+	}
+
+	err := cli.ContainerExecResize(ctx, id, types.ResizeOptions{
+		Height: uint(ws.Height),
+		Width:  uint(ws.Width),
+	})
+	if err != nil {
+		log.Debug("unable to resize exec session", "err", err)
+	}
+}
+
+// execExitCode returns the exit code of the exec session. The output stream
+// can close slightly before docker records the process as exited, so poll
+// for a moment.
+func execExitCode(ctx context.Context, cli *client.Client, id string) (int, error) {
+	for i := 0; ; i++ {
+		inspect, err := cli.ContainerExecInspect(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		if !inspect.Running || i >= 20 {
+			return inspect.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return inspect.ExitCode, nil
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
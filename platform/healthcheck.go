@@ -0,0 +1,79 @@
+package platform
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// healthConfig converts the healthcheck block to docker's health config.
+func (h *HealthcheckConfig) healthConfig() (*container.HealthConfig, error) {
+	if h.Disable {
+		if len(h.Test) > 0 {
+			return nil, fmt.Errorf("test cannot be set when the healthcheck is disabled")
+		}
+		return &container.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+
+	hc := container.HealthConfig{
+		Test:    healthTest(h.Test),
+		Retries: h.Retries,
+	}
+	if h.Retries < 0 {
+		return nil, fmt.Errorf("retries must not be negative")
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"interval", h.Interval, &hc.Interval},
+		{"timeout", h.Timeout, &hc.Timeout},
+		{"start_period", h.StartPeriod, &hc.StartPeriod},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", d.name, d.value, err)
+		}
+		// Docker rejects anything shorter than a millisecond
+		if v < time.Millisecond {
+			return nil, fmt.Errorf("%s must be at least 1ms, got %q", d.name, d.value)
+		}
+		*d.dst = v
+	}
+
+	return &hc, nil
+}
+
+// healthTest converts the test command to the form docker expects, where the
+// first element says how to run the rest.
+func healthTest(test []string) []string {
+	if len(test) == 0 {
+		return nil
+	}
+
+	switch test[0] {
+	case "CMD", "CMD-SHELL", "NONE":
+		return test
+	}
+	if len(test) == 1 {
+		return []string{"CMD-SHELL", test[0]}
+	}
+	return append([]string{"CMD"}, test...)
+}
+
+// lastHealthOutput returns the output of the most recent health check.
+func lastHealthOutput(health *types.Health) string {
+	if health == nil || len(health.Log) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(health.Log[len(health.Log)-1].Output)
+}
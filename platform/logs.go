@@ -0,0 +1,151 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint/builtin/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LogsFunc implements component.LogPlatform
+func (p *Platform) LogsFunc() interface{} {
+	return p.Logs
+}
+
+// Logs follows the logs of the deployment's container and sends them to the
+// log viewer, one event per line. stdout and stderr are reported as separate
+// partitions. The viewer's StartingAt and Limit map to docker's since and
+// tail options.
+func (p *Platform) Logs(
+	ctx context.Context,
+	log hclog.Logger,
+	lv *component.LogViewer,
+	deployment *docker.Deployment,
+) error {
+	cli, err := p.getDockerClient(ctx)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to create Docker client: %s", err)
+	}
+
+	state, err := p.containerState(log, deployment)
+	if err != nil {
+		return err
+	}
+
+	info, err := cli.ContainerInspect(ctx, state.Id)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to inspect container %q: %s", state.Id, err)
+	}
+	name := strings.TrimPrefix(info.Name, "/")
+
+	opts := types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+		Tail:       "all",
+	}
+	if lv.Limit > 0 {
+		opts.Tail = strconv.Itoa(lv.Limit)
+	}
+	if !lv.StartingAt.IsZero() {
+		opts.Since = lv.StartingAt.Format(time.RFC3339Nano)
+	}
+
+	log.Debug("following container logs", "id", state.Id, "tail", opts.Tail, "since", opts.Since)
+	rc, err := cli.ContainerLogs(ctx, state.Id, opts)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to read logs of container %q: %s", name, err)
+	}
+	defer rc.Close()
+
+	stdout := &logWriter{ctx: ctx, partition: name + "/stdout", output: lv.Output}
+	stderr := &logWriter{ctx: ctx, partition: name + "/stderr", output: lv.Output}
+
+	// Containers with a TTY have a single raw stream, otherwise stdout and
+	// stderr are multiplexed.
+	if info.Config.Tty {
+		_, err = io.Copy(stdout, rc)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, rc)
+	}
+	stdout.flush()
+	stderr.flush()
+
+	if ctx.Err() != nil {
+		// The viewer went away, that's not an error.
+		return nil
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "error reading logs of container %q: %s", name, err)
+	}
+	return nil
+}
+
+// logWriter splits the timestamped log stream of docker into lines and
+// sends each one as a component.LogEvent.
+type logWriter struct {
+	ctx       context.Context
+	partition string
+	output    chan<- component.LogEvent
+	buf       []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := string(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		if err := w.send(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// flush sends what is left of an unterminated last line.
+func (w *logWriter) flush() {
+	if len(w.buf) > 0 {
+		w.send(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *logWriter) send(line string) error {
+	ev := component.LogEvent{
+		Partition: w.partition,
+		Timestamp: time.Now(),
+		Message:   strings.TrimSuffix(line, "\r"),
+	}
+
+	// Lines are prefixed with an RFC3339 timestamp when timestamps are on.
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if ts, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+			ev.Timestamp = ts
+			ev.Message = strings.TrimSuffix(line[i+1:], "\r")
+		}
+	}
+
+	select {
+	case w.output <- ev:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/docker/api/types/mount"
+	goUnits "github.com/docker/go-units"
+)
+
+// validateMounts checks the mount blocks, and that no two mounts, volumes or
+// the scratch directory share a target.
+func (c *PlatformConfig) validateMounts() error {
+	targets := map[string]string{}
+	for _, v := range c.Volumes {
+		targets[path.Clean(v.Path)] = fmt.Sprintf("volume %q", v.Name)
+	}
+	if c.ScratchType != scratchNone {
+		targets[path.Clean(c.scratchPath())] = "the scratch directory"
+	}
+
+	for _, m := range c.Mounts {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("invalid mount at %q: %w", m.Target, err)
+		}
+		if other, ok := targets[path.Clean(m.Target)]; ok {
+			return fmt.Errorf("invalid mount at %q: %s is mounted there already", m.Target, other)
+		}
+		targets[path.Clean(m.Target)] = "another mount"
+	}
+	return nil
+}
+
+func (m *MountConfig) validate() error {
+	switch mount.Type(m.Type) {
+	case mount.TypeBind:
+		if m.Source == "" {
+			return fmt.Errorf("bind mounts require a source")
+		}
+	case mount.TypeVolume:
+	case mount.TypeTmpfs:
+		if m.Source != "" {
+			return fmt.Errorf("tmpfs mounts have no source")
+		}
+	default:
+		return fmt.Errorf("type must be one of %q, %q or %q, got %q",
+			mount.TypeBind, mount.TypeVolume, mount.TypeTmpfs, m.Type)
+	}
+
+	if !path.IsAbs(m.Target) {
+		return fmt.Errorf("target must be absolute")
+	}
+
+	switch mount.Consistency(m.Consistency) {
+	case "", mount.ConsistencyFull, mount.ConsistencyCached, mount.ConsistencyDelegated, mount.ConsistencyDefault:
+	default:
+		return fmt.Errorf("consistency must be one of %q, %q, %q or %q, got %q",
+			mount.ConsistencyFull, mount.ConsistencyCached, mount.ConsistencyDelegated,
+			mount.ConsistencyDefault, m.Consistency)
+	}
+
+	if m.Propagation != "" {
+		if mount.Type(m.Type) != mount.TypeBind {
+			return fmt.Errorf("propagation is only supported by bind mounts")
+		}
+		valid := false
+		for _, p := range mount.Propagations {
+			valid = valid || mount.Propagation(m.Propagation) == p
+		}
+		if !valid {
+			return fmt.Errorf("invalid propagation %q", m.Propagation)
+		}
+	}
+
+	if (m.TmpfsSize != "" || m.TmpfsMode != "") && mount.Type(m.Type) != mount.TypeTmpfs {
+		return fmt.Errorf("tmpfs_size and tmpfs_mode are only supported by tmpfs mounts")
+	}
+	_, err := m.tmpfsOptions()
+	return err
+}
+
+func (m *MountConfig) tmpfsOptions() (*mount.TmpfsOptions, error) {
+	if m.TmpfsSize == "" && m.TmpfsMode == "" {
+		return nil, nil
+	}
+
+	var opts mount.TmpfsOptions
+	if m.TmpfsSize != "" {
+		size, err := goUnits.RAMInBytes(m.TmpfsSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tmpfs_size %q: %w", m.TmpfsSize, err)
+		}
+		opts.SizeBytes = size
+	}
+	if m.TmpfsMode != "" {
+		mode, err := strconv.ParseUint(m.TmpfsMode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tmpfs_mode %q, expected an octal file mode", m.TmpfsMode)
+		}
+		opts.Mode = os.FileMode(mode)
+	}
+	return &opts, nil
+}
+
+// mounts returns the mounts of the mount blocks. Relative bind sources are
+// resolved against appPath. With checkSources every bind source must exist,
+// which can only be checked when the daemon runs on this machine.
+func (c *PlatformConfig) mounts(appPath string, checkSources bool) ([]mount.Mount, error) {
+	var mounts []mount.Mount
+	for _, m := range c.Mounts {
+		mnt := mount.Mount{
+			Type:        mount.Type(m.Type),
+			Source:      m.Source,
+			Target:      m.Target,
+			ReadOnly:    m.ReadOnly,
+			Consistency: mount.Consistency(m.Consistency),
+		}
+
+		switch mnt.Type {
+		case mount.TypeBind:
+			src := m.Source
+			if !filepath.IsAbs(src) {
+				src = filepath.Join(appPath, src)
+			}
+			if checkSources {
+				if _, err := os.Stat(src); err != nil {
+					return nil, fmt.Errorf("source of the bind mount at %q: %w", m.Target, err)
+				}
+			}
+			mnt.Source = src
+			if m.Propagation != "" {
+				mnt.BindOptions = &mount.BindOptions{
+					Propagation: mount.Propagation(m.Propagation),
+				}
+			}
+		case mount.TypeTmpfs:
+			opts, err := m.tmpfsOptions()
+			if err != nil {
+				return nil, err
+			}
+			mnt.TmpfsOptions = opts
+		}
+
+		mounts = append(mounts, mnt)
+	}
+	return mounts, nil
+}
@@ -0,0 +1,285 @@
+package platform
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+)
+
+const (
+	defaultNetworkName   = "waypoint"
+	defaultNetworkDriver = "bridge"
+
+	isolateProject   = "project"
+	isolateWorkspace = "workspace"
+
+	// Set on networks created for a single project or workspace. Only
+	// these networks are removed again.
+	labelIsolated = "dockerdesk.isolated"
+)
+
+// Characters docker doesn't allow in network names
+var invalidNetworkChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// deployedContainer is the container of the deployment a status report is
+// generated for. The network status checks that it is attached.
+type deployedContainer struct {
+	Id string
+}
+
+// ref returns the id of the network, or its name for state from earlier
+// versions that did not record the id.
+func (n *Resource_Network) ref() string {
+	if n.Id != "" {
+		return n.Id
+	}
+	return n.Name
+}
+
+// networkConfig returns the network block with its defaults filled in. For
+// isolated networks the name is derived from the project and workspace.
+func (p *Platform) networkConfig(job *component.JobInfo) *NetworkConfig {
+	nc := NetworkConfig{}
+	if p.config.Network != nil {
+		nc = *p.config.Network
+	}
+	switch nc.Isolate {
+	case isolateProject:
+		nc.Name = defaultNetworkName + "-" + job.Project
+	case isolateWorkspace:
+		nc.Name = defaultNetworkName + "-" + job.Project + "-" + job.Workspace
+	}
+	nc.Name = invalidNetworkChars.ReplaceAllString(nc.Name, "-")
+	if nc.Name == "" {
+		nc.Name = defaultNetworkName
+	}
+	if nc.Driver == "" {
+		nc.Driver = defaultNetworkDriver
+	}
+	return &nc
+}
+
+// labels returns the labels of a network created from the block.
+func (nc *NetworkConfig) labels(job *component.JobInfo) map[string]string {
+	labels := map[string]string{
+		"use": nc.Name,
+	}
+	if nc.Isolate != "" {
+		labels[labelIsolated] = nc.Isolate
+		labels["project"] = job.Project
+		labels["workspace"] = job.Workspace
+	}
+	return labels
+}
+
+// validate checks the isolation mode and addresses of the network block.
+func (nc *NetworkConfig) validate() error {
+	switch nc.Isolate {
+	case "", isolateProject, isolateWorkspace:
+	default:
+		return fmt.Errorf("isolate must be %q or %q, got %q", isolateProject, isolateWorkspace, nc.Isolate)
+	}
+	if nc.Isolate != "" && nc.Name != "" {
+		return fmt.Errorf("name cannot be set on an isolated network, it is derived from the %s", nc.Isolate)
+	}
+
+	if err := validateAddresses(nc.IPv4Address, nc.IPv6Address, nc.Links); err != nil {
+		return err
+	}
+	if nc.IPv6Address != "" && !nc.IPv6 {
+		return fmt.Errorf("ipv6_address requires ipv6")
+	}
+	if nc.IPv4Address != "" && nc.Subnet == "" {
+		return fmt.Errorf("ipv4_address requires a subnet")
+	}
+
+	if nc.Gateway != "" && nc.Subnet == "" {
+		return fmt.Errorf("gateway requires a subnet")
+	}
+	if nc.Subnet == "" {
+		return nil
+	}
+
+	_, subnet, err := net.ParseCIDR(nc.Subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %q: %w", nc.Subnet, err)
+	}
+	if nc.Gateway != "" {
+		gw := net.ParseIP(nc.Gateway)
+		if gw == nil {
+			return fmt.Errorf("invalid gateway %q", nc.Gateway)
+		}
+		if !subnet.Contains(gw) {
+			return fmt.Errorf("gateway %s is not in subnet %s", nc.Gateway, nc.Subnet)
+		}
+	}
+	if nc.IPv4Address != "" && !subnet.Contains(net.ParseIP(nc.IPv4Address)) {
+		return fmt.Errorf("ipv4_address %s is not in subnet %s", nc.IPv4Address, nc.Subnet)
+	}
+	return nil
+}
+
+// validateNetworkAttachments checks the network_attachment blocks.
+func (c *PlatformConfig) validateNetworkAttachments() error {
+	seen := map[string]bool{}
+	for _, a := range c.NetworkAttachments {
+		if a.Name == "" {
+			return fmt.Errorf("invalid network_attachment: network name must not be empty")
+		}
+		if seen[a.Name] {
+			return fmt.Errorf("invalid network_attachment %q: network is attached twice", a.Name)
+		}
+		seen[a.Name] = true
+
+		if err := validateAddresses(a.IPv4Address, a.IPv6Address, a.Links); err != nil {
+			return fmt.Errorf("invalid network_attachment %q: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateAddresses(ipv4, ipv6 string, links []string) error {
+	if ipv4 != "" {
+		if ip := net.ParseIP(ipv4); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("ipv4_address %q is not an IPv4 address", ipv4)
+		}
+	}
+	if ipv6 != "" {
+		if ip := net.ParseIP(ipv6); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("ipv6_address %q is not an IPv6 address", ipv6)
+		}
+	}
+	for _, l := range links {
+		parts := strings.Split(l, ":")
+		if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && parts[1] == "") {
+			return fmt.Errorf("link %q must be of the form <container>[:<alias>]", l)
+		}
+	}
+	return nil
+}
+
+// endpoint returns the settings of the container on the network, reachable
+// under the app name and the configured aliases.
+func (nc *NetworkConfig) endpoint(app string) *network.EndpointSettings {
+	return endpointSettings(nc.IPv4Address, nc.IPv6Address, append([]string{app}, nc.Aliases...), nc.Links)
+}
+
+func endpointSettings(ipv4, ipv6 string, aliases, links []string) *network.EndpointSettings {
+	es := &network.EndpointSettings{
+		Aliases: aliases,
+		Links:   links,
+	}
+	if ipv4 != "" || ipv6 != "" {
+		es.IPAMConfig = &network.EndpointIPAMConfig{
+			IPv4Address: ipv4,
+			IPv6Address: ipv6,
+		}
+	}
+	return es
+}
+
+// networkAttachment is an additional network the container is connected to
+// once it is created.
+type networkAttachment struct {
+	Network  string
+	Endpoint *network.EndpointSettings
+}
+
+// networkAttachments returns the additional networks of the networks list
+// and the network_attachment blocks.
+func (c *PlatformConfig) networkAttachments() []networkAttachment {
+	var attachments []networkAttachment
+	seen := map[string]bool{}
+	for _, a := range c.NetworkAttachments {
+		attachments = append(attachments, networkAttachment{
+			Network:  a.Name,
+			Endpoint: endpointSettings(a.IPv4Address, a.IPv6Address, a.Aliases, a.Links),
+		})
+		seen[a.Name] = true
+	}
+	for _, n := range c.Networks {
+		if seen[n] {
+			continue
+		}
+		attachments = append(attachments, networkAttachment{
+			Network:  n,
+			Endpoint: &network.EndpointSettings{},
+		})
+		seen[n] = true
+	}
+	return attachments
+}
+
+// unpinAddresses returns copies of the network settings without static
+// addresses, so a container can run next to the one holding them.
+func unpinAddresses(
+	netconfig *network.NetworkingConfig,
+	attachments []networkAttachment,
+) (*network.NetworkingConfig, []networkAttachment) {
+	unpinned := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{},
+	}
+	for name, es := range netconfig.EndpointsConfig {
+		c := *es
+		c.IPAMConfig = nil
+		unpinned.EndpointsConfig[name] = &c
+	}
+
+	var unpinnedAttachments []networkAttachment
+	for _, a := range attachments {
+		c := *a.Endpoint
+		c.IPAMConfig = nil
+		unpinnedAttachments = append(unpinnedAttachments, networkAttachment{Network: a.Network, Endpoint: &c})
+	}
+	return unpinned, unpinnedAttachments
+}
+
+func hasStaticAddresses(netconfig *network.NetworkingConfig, attachments []networkAttachment) bool {
+	for _, es := range netconfig.EndpointsConfig {
+		if es.IPAMConfig != nil {
+			return true
+		}
+	}
+	for _, a := range attachments {
+		if a.Endpoint.IPAMConfig != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (nc *NetworkConfig) ipam() *network.IPAM {
+	if nc.Subnet == "" {
+		return nil
+	}
+	return &network.IPAM{
+		Config: []network.IPAMConfig{
+			{
+				Subnet:  nc.Subnet,
+				Gateway: nc.Gateway,
+			},
+		},
+	}
+}
+
+// matches checks that an existing network has the driver and subnet the
+// block asks for, so apps don't silently end up on the wrong network.
+func (nc *NetworkConfig) matches(existing types.NetworkResource) error {
+	if existing.Driver != nc.Driver {
+		return fmt.Errorf("driver is %q, expected %q", existing.Driver, nc.Driver)
+	}
+	if nc.Subnet == "" {
+		return nil
+	}
+	for _, c := range existing.IPAM.Config {
+		if c.Subnet == nc.Subnet {
+			return nil
+		}
+	}
+	return fmt.Errorf("subnet %s is not configured on the network", nc.Subnet)
+}
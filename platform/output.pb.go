@@ -0,0 +1,351 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.17.3
+// source: platform/output.proto
+
+package platform
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Resource struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *Resource) Reset() {
+	*x = Resource{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_platform_output_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Resource) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resource) ProtoMessage() {}
+
+func (x *Resource) ProtoReflect() protoreflect.Message {
+	mi := &file_platform_output_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resource.ProtoReflect.Descriptor instead.
+func (*Resource) Descriptor() ([]byte, []int) {
+	return file_platform_output_proto_rawDescGZIP(), []int{0}
+}
+
+type Resource_Network struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Id   string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *Resource_Network) Reset() {
+	*x = Resource_Network{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_platform_output_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Resource_Network) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resource_Network) ProtoMessage() {}
+
+func (x *Resource_Network) ProtoReflect() protoreflect.Message {
+	mi := &file_platform_output_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resource_Network.ProtoReflect.Descriptor instead.
+func (*Resource_Network) Descriptor() ([]byte, []int) {
+	return file_platform_output_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *Resource_Network) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Resource_Network) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Resource_Volumes struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Volumes []*Resource_Volume `protobuf:"bytes,1,rep,name=volumes,proto3" json:"volumes,omitempty"`
+}
+
+func (x *Resource_Volumes) Reset() {
+	*x = Resource_Volumes{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_platform_output_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Resource_Volumes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resource_Volumes) ProtoMessage() {}
+
+func (x *Resource_Volumes) ProtoReflect() protoreflect.Message {
+	mi := &file_platform_output_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resource_Volumes.ProtoReflect.Descriptor instead.
+func (*Resource_Volumes) Descriptor() ([]byte, []int) {
+	return file_platform_output_proto_rawDescGZIP(), []int{0, 1}
+}
+
+func (x *Resource_Volumes) GetVolumes() []*Resource_Volume {
+	if x != nil {
+		return x.Volumes
+	}
+	return nil
+}
+
+type Resource_Volume struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name            string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Driver          string `protobuf:"bytes,2,opt,name=driver,proto3" json:"driver,omitempty"`
+	RemoveOnDestroy bool   `protobuf:"varint,3,opt,name=remove_on_destroy,json=removeOnDestroy,proto3" json:"remove_on_destroy,omitempty"`
+}
+
+func (x *Resource_Volume) Reset() {
+	*x = Resource_Volume{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_platform_output_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Resource_Volume) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resource_Volume) ProtoMessage() {}
+
+func (x *Resource_Volume) ProtoReflect() protoreflect.Message {
+	mi := &file_platform_output_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resource_Volume.ProtoReflect.Descriptor instead.
+func (*Resource_Volume) Descriptor() ([]byte, []int) {
+	return file_platform_output_proto_rawDescGZIP(), []int{0, 2}
+}
+
+func (x *Resource_Volume) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Resource_Volume) GetDriver() string {
+	if x != nil {
+		return x.Driver
+	}
+	return ""
+}
+
+func (x *Resource_Volume) GetRemoveOnDestroy() bool {
+	if x != nil {
+		return x.RemoveOnDestroy
+	}
+	return false
+}
+
+var File_platform_output_proto protoreflect.FileDescriptor
+
+var file_platform_output_proto_rawDesc = []byte{
+	0x0a, 0x15, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x2f, 0x6f, 0x75, 0x74, 0x70, 0x75,
+	0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72,
+	0x6d, 0x22, 0xdb, 0x01, 0x0a, 0x08, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x1a, 0x2d,
+	0x0a, 0x07, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x1a, 0x3e, 0x0a,
+	0x07, 0x56, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x73, 0x12, 0x33, 0x0a, 0x07, 0x76, 0x6f, 0x6c, 0x75,
+	0x6d, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x70, 0x6c, 0x61, 0x74,
+	0x66, 0x6f, 0x72, 0x6d, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x2e, 0x56, 0x6f,
+	0x6c, 0x75, 0x6d, 0x65, 0x52, 0x07, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x73, 0x1a, 0x60, 0x0a,
+	0x06, 0x56, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x64,
+	0x72, 0x69, 0x76, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x72, 0x69,
+	0x76, 0x65, 0x72, 0x12, 0x2a, 0x0a, 0x11, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x5f, 0x6f, 0x6e,
+	0x5f, 0x64, 0x65, 0x73, 0x74, 0x72, 0x6f, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f,
+	0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x4f, 0x6e, 0x44, 0x65, 0x73, 0x74, 0x72, 0x6f, 0x79, 0x42,
+	0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x31, 0x78,
+	0x79, 0x7a, 0x2f, 0x64, 0x6f, 0x63, 0x6b, 0x65, 0x72, 0x64, 0x65, 0x73, 0x6b, 0x2f, 0x70, 0x6c,
+	0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_platform_output_proto_rawDescOnce sync.Once
+	file_platform_output_proto_rawDescData = file_platform_output_proto_rawDesc
+)
+
+func file_platform_output_proto_rawDescGZIP() []byte {
+	file_platform_output_proto_rawDescOnce.Do(func() {
+		file_platform_output_proto_rawDescData = protoimpl.X.CompressGZIP(file_platform_output_proto_rawDescData)
+	})
+	return file_platform_output_proto_rawDescData
+}
+
+var file_platform_output_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_platform_output_proto_goTypes = []interface{}{
+	(*Resource)(nil),         // 0: platform.Resource
+	(*Resource_Network)(nil), // 1: platform.Resource.Network
+	(*Resource_Volumes)(nil), // 2: platform.Resource.Volumes
+	(*Resource_Volume)(nil),  // 3: platform.Resource.Volume
+}
+var file_platform_output_proto_depIdxs = []int32{
+	3, // 0: platform.Resource.Volumes.volumes:type_name -> platform.Resource.Volume
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_platform_output_proto_init() }
+func file_platform_output_proto_init() {
+	if File_platform_output_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_platform_output_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Resource); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_platform_output_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Resource_Network); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_platform_output_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Resource_Volumes); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_platform_output_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Resource_Volume); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_platform_output_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_platform_output_proto_goTypes,
+		DependencyIndexes: file_platform_output_proto_depIdxs,
+		MessageInfos:      file_platform_output_proto_msgTypes,
+	}.Build()
+	File_platform_output_proto = out.File
+	file_platform_output_proto_rawDesc = nil
+	file_platform_output_proto_goTypes = nil
+	file_platform_output_proto_depIdxs = nil
+}
@@ -4,9 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,9 +15,7 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/go-connections/nat"
-	goUnits "github.com/docker/go-units"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/waypoint-plugin-sdk/component"
 	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
@@ -28,6 +25,8 @@ import (
 	wpdockerclient "github.com/hashicorp/waypoint/builtin/docker/client"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -35,6 +34,15 @@ const (
 	platformName = "dockerdev"
 	labelId      = "waypoint.hashicorp.com/id"
 	labelNonce   = "waypoint.hashicorp.com/nonce"
+
+	// How long a blue/green redeploy waits for the new container to become
+	// healthy before giving up and keeping the previous container, unless
+	// a readiness block sets the timeout.
+	blueGreenTimeout = 2 * time.Minute
+
+	// How long a container without a health check must stay running to be
+	// considered healthy.
+	containerSettleTime = 2 * time.Second
 )
 
 func (p *Platform) resourceManager(log hclog.Logger, dcr *component.DeclaredResourcesResp) *resource.Manager {
@@ -44,17 +52,28 @@ func (p *Platform) resourceManager(log hclog.Logger, dcr *component.DeclaredReso
 		resource.WithDeclaredResourcesResp(dcr),
 		resource.WithResource(resource.NewResource(
 			resource.WithName("network"),
-			resource.WithState(&docker.Resource_Network{}),
+			resource.WithState(&Resource_Network{}),
 			resource.WithCreate(p.resourceNetworkCreate),
-			// networks have no destroy logic, we leave the network
-			// lingering around for now. This was the logic prior to
-			// refactoring into the resource manager so we kept it.
-
+			// Only isolated networks are destroyed, once no container is
+			// attached anymore. The shared network is left lingering
+			// around, as it was prior to refactoring into the resource
+			// manager.
+			resource.WithDestroy(p.resourceNetworkDestroy),
 			resource.WithStatus(p.resourceNetworkStatus),
 			resource.WithPlatform(platformName),
 			resource.WithCategoryDisplayHint(sdk.ResourceCategoryDisplayHint_ROUTER), // Not a perfect fit but good enough.
 		)),
 
+		resource.WithResource(resource.NewResource(
+			resource.WithName("volume"),
+			resource.WithState(&Resource_Volumes{}),
+			resource.WithCreate(p.resourceVolumeCreate),
+			resource.WithDestroy(p.resourceVolumeDestroy),
+			resource.WithStatus(p.resourceVolumeStatus),
+			resource.WithPlatform(platformName),
+			resource.WithCategoryDisplayHint(sdk.ResourceCategoryDisplayHint_STORAGE),
+		)),
+
 		resource.WithResource(resource.NewResource(
 			resource.WithName("container"),
 			resource.WithState(&docker.Resource_Container{}),
@@ -67,16 +86,74 @@ func (p *Platform) resourceManager(log hclog.Logger, dcr *component.DeclaredReso
 	)
 }
 
+// containerState returns the container resource state of the deployment,
+// falling back to the container id for deployments from older versions that
+// have no resource state.
+func (p *Platform) containerState(log hclog.Logger, deployment *docker.Deployment) (*docker.Resource_Container, error) {
+	if deployment.ResourceState == nil {
+		return &docker.Resource_Container{Id: deployment.Container}, nil
+	}
+
+	rm := p.resourceManager(log, nil)
+	if err := loadState(rm, deployment.ResourceState); err != nil {
+		return nil, status.Errorf(codes.Internal, "resource manager failed to load state: %s", err)
+	}
+
+	state, ok := rm.Resource("container").State().(*docker.Resource_Container)
+	if !ok || state == nil || state.Id == "" {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"deployment %q has no container state", deployment.Id)
+	}
+	return state, nil
+}
+
+// loadState loads the resource state of a deployment. Deployments from
+// earlier versions stored the network as a docker.Resource_Network, which is
+// wire compatible with Resource_Network, so it is relabeled before loading.
+func loadState(rm *resource.Manager, v *anypb.Any) error {
+	var state sdk.Framework_ResourceManagerState
+	if err := v.UnmarshalTo(&state); err != nil {
+		return err
+	}
+
+	// The generated types are only registered once the package is
+	// initialized, so the type URL can't be a package level var
+	typeUrl := "type.googleapis.com/" + string(proto.MessageName(&Resource_Network{}))
+
+	migrated := false
+	for _, r := range state.Resources {
+		if r.Raw != nil && r.Raw.MessageIs(&docker.Resource_Network{}) {
+			r.Raw.TypeUrl = typeUrl
+			migrated = true
+		}
+	}
+	if !migrated {
+		return rm.LoadState(v)
+	}
+
+	v, err := anypb.New(&state)
+	if err != nil {
+		return err
+	}
+	return rm.LoadState(v)
+}
+
 func (p *Platform) getDockerClient(ctx context.Context) (*client.Client, error) {
-	if p.config.ClientConfig == nil {
+	return NewDockerClient(ctx, p.config.ClientConfig)
+}
+
+// NewDockerClient returns a client for the Docker engine described by c,
+// falling back to the DOCKER_* env vars when c is nil.
+func NewDockerClient(ctx context.Context, c *ClientConfig) (*client.Client, error) {
+	if c == nil {
 		return wpdockerclient.NewClientWithOpts(client.FromEnv)
 	}
 	opts := []client.Opt{}
-	if host := p.config.ClientConfig.Host; host != "" {
+	if host := c.Host; host != "" {
 		opts = append(opts, client.WithHost(host))
 	}
 
-	if path := p.config.ClientConfig.CertPath; path != "" {
+	if path := c.CertPath; path != "" {
 		opts = append(opts, client.WithTLSClientConfig(
 			filepath.Join(path, "ca.pem"),
 			filepath.Join(path, "cert.pem"),
@@ -84,7 +161,7 @@ func (p *Platform) getDockerClient(ctx context.Context) (*client.Client, error)
 		))
 	}
 
-	if version := p.config.ClientConfig.APIVersion; version != "" {
+	if version := c.APIVersion; version != "" {
 		opts = append(opts, client.WithVersion(version))
 	}
 
@@ -100,39 +177,100 @@ func (p *Platform) getDockerClient(ctx context.Context) (*client.Client, error)
 func (p *Platform) resourceNetworkCreate(
 	ctx context.Context,
 	cli *client.Client,
+	job *component.JobInfo,
 	sg terminal.StepGroup,
-	state *docker.Resource_Network,
+	state *Resource_Network,
 ) error {
 	s := sg.Add("Setting up network...")
 	defer func() { s.Abort() }()
 
-	nets, err := cli.NetworkList(ctx, types.NetworkListOptions{
-		Filters: filters.NewArgs(filters.Arg("label", "use=waypoint")),
-	})
-	if err != nil {
-		return status.Errorf(codes.FailedPrecondition, "unable to list Docker networks: %s", err)
+	nc := p.networkConfig(job)
+	existing, err := cli.NetworkInspect(ctx, nc.Name, types.NetworkInspectOptions{})
+	if err != nil && !client.IsErrNotFound(err) {
+		return status.Errorf(codes.FailedPrecondition, "unable to inspect Docker network %q: %s", nc.Name, err)
 	}
 
 	// If we have a network already we're done. If we don't have a net, create it.
-	if len(nets) == 0 {
-		_, err = cli.NetworkCreate(ctx, "waypoint", types.NetworkCreate{
-			Driver:         "bridge",
+	id := existing.ID
+	if err == nil {
+		if err := nc.matches(existing); err != nil {
+			return status.Errorf(codes.FailedPrecondition,
+				"Docker network %q exists with different settings: %s", nc.Name, err)
+		}
+	} else {
+		s.Update("Creating network %s...", nc.Name)
+		resp, err := cli.NetworkCreate(ctx, nc.Name, types.NetworkCreate{
+			Driver:         nc.Driver,
 			CheckDuplicate: true,
-			Internal:       false,
+			EnableIPv6:     nc.IPv6,
+			IPAM:           nc.ipam(),
+			Internal:       nc.Internal,
 			Attachable:     true,
-			Labels: map[string]string{
-				"use": "waypoint",
-			},
+			Options:        nc.DriverOpts,
+			Labels:         nc.labels(job),
 		})
 		if err != nil {
 			return status.Errorf(codes.FailedPrecondition, "unable to create Docker network: %s", err)
 		}
+		id = resp.ID
 	}
+	s.Update("Using network %s", nc.Name)
 	s.Done()
 
 	// Set our state
-	state.Name = "waypoint"
+	state.Name = nc.Name
+	state.Id = id
+
+	return nil
+}
+
+func (p *Platform) resourceNetworkDestroy(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	sg terminal.StepGroup,
+	state *Resource_Network,
+) error {
+	// Deployments from older versions have no network state
+	if state.Name == "" {
+		return nil
+	}
 
+	net, err := cli.NetworkInspect(ctx, state.ref(), types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to inspect Docker network %q: %s", state.Name, err)
+	}
+
+	if _, ok := net.Labels[labelIsolated]; !ok {
+		return nil
+	}
+
+	// The inspect only lists running endpoints, stopped containers keep
+	// their attachment and would fail the removal.
+	attached, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("network", net.ID)),
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to list containers on Docker network %q: %s", state.Name, err)
+	}
+	if len(attached) > 0 {
+		log.Debug("network still has containers attached, leaving it in place",
+			"network", state.Name, "containers", len(attached))
+		return nil
+	}
+
+	s := sg.Add("Deleting network: %s", state.Name)
+	defer func() { s.Abort() }()
+
+	if err := cli.NetworkRemove(ctx, net.ID); err != nil && !client.IsErrNotFound(err) {
+		return status.Errorf(codes.Internal, "unable to remove Docker network %q: %s", state.Name, err)
+	}
+
+	s.Done()
 	return nil
 }
 
@@ -141,47 +279,70 @@ func (p *Platform) resourceNetworkStatus(
 	log hclog.Logger,
 	sg terminal.StepGroup,
 	cli *client.Client,
-	network *docker.Resource_Network,
+	network *Resource_Network,
+	deployed *deployedContainer,
 	sr *resource.StatusResponse,
 ) error {
 	s := sg.Add("Checking status of the Docker network resource...")
 	defer s.Abort()
 
-	log.Debug("querying docker for network status")
+	log.Debug("querying docker for network status", "network", network.ref())
 
-	nets, err := cli.NetworkList(ctx, types.NetworkListOptions{
-		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("use=%s", network.Name))),
-	})
-	if err != nil {
-		return status.Errorf(codes.FailedPrecondition, "unable to list Docker networks: %s", err)
-	}
-	if len(nets) == 0 {
+	net, err := cli.NetworkInspect(ctx, network.ref(), types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
 		sr.Resources = append(sr.Resources, &sdk.StatusReport_Resource{
 			Name:                network.Name,
+			Id:                  network.Id,
 			CategoryDisplayHint: sdk.ResourceCategoryDisplayHint_ROUTER,
 			Health:              sdk.StatusReport_MISSING,
 		})
-	} else {
-		// There shouldn't be multiple networks, but if there are somehow we should show them
-		for _, net := range nets {
-			netJson, err := json.Marshal(map[string]interface{}{
-				"dockerNetwork": net,
-			})
-			if err != nil {
-				return status.Errorf(codes.FailedPrecondition, "failed to marshal docker network status for network with id %q: %s", net.ID, err)
-			}
-			sr.Resources = append(sr.Resources, &sdk.StatusReport_Resource{
-				Name:                net.Name,
-				Id:                  net.ID,
-				CategoryDisplayHint: sdk.ResourceCategoryDisplayHint_ROUTER,
-				Health:              sdk.StatusReport_READY, // Not that many states a network can be in, if it exists.
-				HealthMessage:       "exists",
-				StateJson:           string(netJson),
-				CreatedTime:         timestamppb.New(net.Created),
-			})
+
+		s.Update("Finished building report for Docker network resource")
+		s.Done()
+		return nil
+	}
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to inspect Docker network %q: %s", network.ref(), err)
+	}
+
+	var subnets []string
+	for _, c := range net.IPAM.Config {
+		subnets = append(subnets, c.Subnet)
+	}
+	var containers []string
+	for _, c := range net.Containers {
+		containers = append(containers, c.Name)
+	}
+	sort.Strings(containers)
+
+	health := sdk.StatusReport_READY
+	healthMessage := fmt.Sprintf("%s network with %d attached container(s)", net.Driver, len(containers))
+	if deployed != nil && deployed.Id != "" {
+		if _, ok := net.Containers[deployed.Id]; !ok {
+			health = sdk.StatusReport_PARTIAL
+			healthMessage = "the deployment's container is not attached to the network"
 		}
 	}
 
+	netJson, err := json.Marshal(map[string]interface{}{
+		"dockerNetwork": net,
+		"driver":        net.Driver,
+		"subnets":       subnets,
+		"containers":    containers,
+	})
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "failed to marshal docker network status for network with id %q: %s", net.ID, err)
+	}
+	sr.Resources = append(sr.Resources, &sdk.StatusReport_Resource{
+		Name:                net.Name,
+		Id:                  net.ID,
+		CategoryDisplayHint: sdk.ResourceCategoryDisplayHint_ROUTER,
+		Health:              health,
+		HealthMessage:       healthMessage,
+		StateJson:           string(netJson),
+		CreatedTime:         timestamppb.New(net.Created),
+	})
+
 	s.Update("Finished building report for Docker network resource")
 	s.Done()
 	return nil
@@ -199,10 +360,11 @@ func (p *Platform) resourceContainerCreate(
 	sg terminal.StepGroup,
 	ui terminal.UI,
 	state *docker.Resource_Container,
-	netState *docker.Resource_Network,
+	netState *Resource_Network,
+	_ *Resource_Volumes, // the volumes must exist before the container mounts them
 ) error {
 	// Pull the image
-	err := p.pullImage(cli, log, ui, img, p.config.ForcePull)
+	err := p.pullImage(ctx, cli, log, ui, img, p.config.pullPolicy())
 	if err != nil {
 		return status.Errorf(codes.FailedPrecondition,
 			"unable to pull image from Docker registry: %s", err)
@@ -214,22 +376,13 @@ func (p *Platform) resourceContainerCreate(
 	portBindings := nat.PortMap{}
 	exposedPorts := nat.PortSet{}
 
-	pfs, err := parsePublishPorts(p.config.PublishedPorts)
+	mappings, err := p.config.publishedPorts()
 	if err != nil {
-		return fmt.Errorf("parsePublishedPort %v %w", p.config.PublishedPorts, err)
+		return status.Errorf(codes.InvalidArgument, "%s", err)
 	}
-	for i := range pfs {
-		pf := pfs[i]
-		np, err := nat.NewPort(pf.Proto, pf.ContainerPort)
-		if err != nil {
-			return fmt.Errorf("createPort from %v err = %w", pf, err)
-		}
-		exposedPorts[np] = struct{}{}
-		portBindings[np] = []nat.PortBinding{
-			{
-				HostPort: pf.HostPort,
-			},
-		}
+	for _, m := range mappings {
+		exposedPorts[m.Port] = struct{}{}
+		portBindings[m.Port] = append(portBindings[m.Port], m.Binding)
 	}
 
 	for _, port := range append(p.config.ExtraPorts, p.config.ServicePort) {
@@ -239,6 +392,10 @@ func (p *Platform) resourceContainerCreate(
 		}
 
 		exposedPorts[np] = struct{}{}
+		if _, ok := portBindings[np]; ok {
+			// Already published on the host ports it was pinned to
+			continue
+		}
 		portBindings[np] = []nat.PortBinding{
 			{
 				HostPort: "", // this is intentionally left empty for a random host port assignment
@@ -255,38 +412,63 @@ func (p *Platform) resourceContainerCreate(
 		Image:        img.Image + ":" + img.Tag,
 		ExposedPorts: exposedPorts,
 		Env:          []string{"PORT=" + fmt.Sprint(p.config.ServicePort)},
+		User:         p.config.User,
+		WorkingDir:   p.config.WorkingDir,
+		Hostname:     p.config.Hostname,
+		Domainname:   p.config.Domainname,
 	}
 	if c := p.config.Command; len(c) > 0 {
 		cfg.Cmd = c
 	}
+	if e := p.config.Entrypoint; len(e) > 0 {
+		cfg.Entrypoint = e
+	}
+	if err := p.config.setStop(&cfg); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if p.config.Healthcheck != nil {
+		hc, err := p.config.Healthcheck.healthConfig()
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid healthcheck: %s", err)
+		}
+		cfg.Healthcheck = hc
+	}
 
-	// default container binds
-	containerBinds := []string{src.App + "-scratch" + ":/input"}
-	if p.config.Binds != nil {
-		containerBinds = append(containerBinds, p.config.Binds...)
+	// The scratch directory, volumes and mount blocks are mounted next to
+	// the binds. Bind sources are only checked for a local daemon, a remote
+	// one has them on its own machine.
+	mounts, err := p.config.mounts(src.Path, localDaemon(cli))
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "invalid mount: %s", err)
+	}
+	mounts = append(mounts, p.config.volumeMounts()...)
+	shared := sharedVolumes(mounts)
+	scratch, err := p.config.scratchMount(src.App)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid scratch space: %s", err)
+	}
+	if scratch != nil {
+		mounts = append(mounts, *scratch)
 	}
 
 	// Setup the resource requirements for the container if given
-	var resources container.Resources
-	if p.config.Resources != nil {
-		memory, err := goUnits.FromHumanSize(p.config.Resources["memory"])
-		if err != nil {
-			return err
-		}
-		resources.Memory = memory
+	resources, err := p.config.resources()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid resources: %s", err)
+	}
 
-		cpu, err := strconv.ParseInt(p.config.Resources["cpu"], 10, 64)
-		if err != nil {
-			return err
-		}
-		resources.CPUShares = cpu
+	restartPolicy, err := p.config.restartPolicy()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid restart_policy: %s", err)
 	}
 
 	// Build our host configuration from the bindings, ports, and resources.
 	hostconfig := container.HostConfig{
-		Binds:        containerBinds,
-		PortBindings: portBindings,
-		Resources:    resources,
+		Binds:         p.config.Binds,
+		Mounts:        mounts,
+		PortBindings:  portBindings,
+		Resources:     resources,
+		RestartPolicy: restartPolicy,
 	}
 
 	// Containers can only be connected to 1 network at creation time
@@ -294,11 +476,10 @@ func (p *Platform) resourceContainerCreate(
 	// created.
 	netconfig := network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
-			netState.Name: {
-				Aliases: []string{src.App},
-			},
+			netState.Name: p.networkConfig(job).endpoint(src.App),
 		},
 	}
+	attachments := p.config.networkAttachments()
 
 	for k, v := range p.config.StaticEnvVars {
 		cfg.Env = append(cfg.Env, k+"="+v)
@@ -325,10 +506,231 @@ func (p *Platform) resourceContainerCreate(
 
 	// Create the container
 	name := src.App + "-" + result.Id
+	var prev *types.ContainerJSON
 	if p.config.UseAppAsContainerName {
 		name = src.App
+		info, err := cli.ContainerInspect(ctx, name)
+		if err == nil && ownedBy(&info, src.App) {
+			prev = &info
+		} else if err == nil {
+			// Not a deployment of this app, leave it alone
+			log.Warn("container with the app name is not a deployment of the app", "name", name, "id", info.ID)
+		} else if !client.IsErrNotFound(err) {
+			return status.Errorf(codes.Internal, "unable to inspect container %q: %s", name, err)
+		}
+	}
+
+	// The container being replaced may hold the pinned ports, it gives them
+	// up before the new container binds them.
+	var replacing string
+	if prev != nil {
+		replacing = prev.ID
 	}
-	cr, err := cli.ContainerCreate(ctx, &cfg, &hostconfig, &netconfig, nil, name)
+	if err := p.checkPortConflicts(ctx, log, cli, ui, s, src.App, hostconfig.PortBindings, replacing); err != nil {
+		return err
+	}
+
+	if prev == nil {
+		if err := p.runContainer(ctx, log, cli, s, state, name, &cfg, &hostconfig, &netconfig, attachments, false); err != nil {
+			return err
+		}
+		s.Done()
+		return nil
+	}
+
+	if len(shared) > 0 {
+		return p.replaceContainer(ctx, log, cli, s, state, name, prev, shared, &cfg, &hostconfig, &netconfig, attachments)
+	}
+
+	// A container already holds the app name. Start the new one next to it
+	// under a temporary name, with pinned host ports published on random
+	// ports and without static addresses, so the previous container keeps
+	// serving until the new one is up.
+	tmpName := src.App + "-" + result.Id
+	candidate := hostconfig
+	candidate.PortBindings = unpinPortBindings(hostconfig.PortBindings)
+	candidateNet, candidateAttachments := unpinAddresses(&netconfig, attachments)
+
+	s.Update("Starting container %s next to %s...", tmpName, name)
+	err = p.runContainer(ctx, log, cli, s, state, tmpName, &cfg, &candidate, candidateNet, candidateAttachments, true)
+	if err != nil {
+		return status.Errorf(codes.Unavailable,
+			"new container did not start, %s is still serving: %s", name, err)
+	}
+
+	// Without a timeout docker uses the stop_timeout of the container
+	s.Update("Stopping previous container %s...", name)
+	if err := cli.ContainerStop(ctx, prev.ID, nil); err != nil && !client.IsErrNotFound(err) {
+		return status.Errorf(codes.Internal, "unable to stop previous container %q: %s", name, err)
+	}
+
+	if p.config.RollbackOnFailure {
+		// Keep the stopped previous container until the new one serves under
+		// the app name, so it can be brought back if that fails.
+		if err := cli.ContainerRename(ctx, prev.ID, previousName(name, prev.ID)); err != nil {
+			return status.Errorf(codes.Internal, "unable to rename previous container %q: %s", name, err)
+		}
+	} else if err := removeContainer(ctx, cli, prev.ID); err != nil {
+		return status.Errorf(codes.Internal, "unable to remove previous container %q: %s", name, err)
+	}
+
+	err = p.takeOverName(ctx, log, cli, s, state, name, &cfg, &hostconfig, &netconfig, attachments)
+	if err != nil {
+		if !p.config.RollbackOnFailure {
+			return err
+		}
+
+		s.Update("Restoring previous container %s...", name)
+		if rbErr := restoreContainer(ctx, cli, prev.ID, name); rbErr != nil {
+			return status.Errorf(codes.Internal,
+				"%s; restoring the previous container also failed: %s", err, rbErr)
+		}
+		return status.Errorf(codes.Aborted, "%s; the previous container was restored", err)
+	}
+
+	if p.config.RollbackOnFailure {
+		if err := removeContainer(ctx, cli, prev.ID); err != nil {
+			log.Warn("unable to remove previous container", "id", prev.ID, "err", err)
+		}
+	}
+	s.Done()
+
+	return nil
+}
+
+// replaceContainer replaces the previous container when the new one can't
+// start next to it, because both would write to the same volumes. The
+// previous container is stopped first and kept under another name until the
+// new one is ready, and is brought back if it does not become ready.
+func (p *Platform) replaceContainer(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	s terminal.Step,
+	state *docker.Resource_Container,
+	name string,
+	prev *types.ContainerJSON,
+	shared []string,
+	cfg *container.Config,
+	hostconfig *container.HostConfig,
+	netconfig *network.NetworkingConfig,
+	attachments []networkAttachment,
+) error {
+	// Without a timeout docker uses the stop_timeout of the container
+	s.Update("Stopping previous container %s, it shares volume(s) %s...", name, strings.Join(shared, ", "))
+	if err := cli.ContainerStop(ctx, prev.ID, nil); err != nil && !client.IsErrNotFound(err) {
+		return status.Errorf(codes.Internal, "unable to stop previous container %q: %s", name, err)
+	}
+	if err := cli.ContainerRename(ctx, prev.ID, previousName(name, prev.ID)); err != nil {
+		return status.Errorf(codes.Internal, "unable to rename previous container %q: %s", name, err)
+	}
+
+	err := p.runContainer(ctx, log, cli, s, state, name, cfg, hostconfig, netconfig, attachments, true)
+	if err != nil {
+		s.Update("Restoring previous container %s...", name)
+		if rbErr := restoreContainer(ctx, cli, prev.ID, name); rbErr != nil {
+			return status.Errorf(codes.Internal,
+				"%s; restoring the previous container also failed: %s", err, rbErr)
+		}
+		return status.Errorf(codes.Aborted, "%s; the previous container was restored", err)
+	}
+
+	if err := removeContainer(ctx, cli, prev.ID); err != nil {
+		log.Warn("unable to remove previous container", "id", prev.ID, "err", err)
+	}
+	s.Done()
+	return nil
+}
+
+// takeOverName moves the verified new container to the app name once the
+// previous container is out of the way.
+func (p *Platform) takeOverName(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	s terminal.Step,
+	state *docker.Resource_Container,
+	name string,
+	cfg *container.Config,
+	hostconfig *container.HostConfig,
+	netconfig *network.NetworkingConfig,
+	attachments []networkAttachment,
+) error {
+	if !hasPinnedPorts(hostconfig.PortBindings) && !hasStaticAddresses(netconfig, attachments) {
+		s.Update("Renaming container %s to %s...", state.Name, name)
+		if err := cli.ContainerRename(ctx, state.Id, name); err != nil {
+			return status.Errorf(codes.Internal, "unable to rename container to %q: %s", name, err)
+		}
+		state.Name = name
+		return nil
+	}
+
+	// Docker cannot change the port bindings of an existing container, so
+	// the verified container is replaced by one that binds the pinned ports
+	// and static addresses under the app name. This is the only gap in
+	// serving.
+	s.Update("Stopping %s to rebind published ports and addresses to %s...", state.Name, name)
+	if err := removeContainer(ctx, cli, state.Id); err != nil {
+		return status.Errorf(codes.Internal, "unable to remove container %q: %s", state.Name, err)
+	}
+	return p.runContainer(ctx, log, cli, s, state, name, cfg, hostconfig, netconfig, attachments, false)
+}
+
+// runContainer starts the container and waits for it to be ready. A container
+// that fails to start or become ready is removed again, and the state is
+// cleared so nothing is left behind to block the next deploy.
+func (p *Platform) runContainer(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	s terminal.Step,
+	state *docker.Resource_Container,
+	name string,
+	cfg *container.Config,
+	hostconfig *container.HostConfig,
+	netconfig *network.NetworkingConfig,
+	attachments []networkAttachment,
+	requireReady bool,
+) error {
+	// The container is created on a single network, see deploy
+	var netName string
+	for n := range netconfig.EndpointsConfig {
+		netName = n
+	}
+
+	err := p.startContainer(ctx, cli, s, state, name, cfg, hostconfig, netconfig, attachments)
+	if err == nil {
+		err = p.waitForReady(ctx, cli, s, state.Id, netName, requireReady)
+	}
+	if err == nil || state.Id == "" {
+		return err
+	}
+
+	log.Warn("removing container that failed to start", "name", name, "id", state.Id, "err", err)
+	if rmErr := removeContainer(ctx, cli, state.Id); rmErr != nil {
+		log.Warn("unable to remove failed container", "id", state.Id, "err", rmErr)
+		return err
+	}
+	state.Id = ""
+	state.Name = ""
+
+	return err
+}
+
+// startContainer creates the container, connects it to the additional
+// networks and starts it. The state is set as soon as the container exists.
+func (p *Platform) startContainer(
+	ctx context.Context,
+	cli *client.Client,
+	s terminal.Step,
+	state *docker.Resource_Container,
+	name string,
+	cfg *container.Config,
+	hostconfig *container.HostConfig,
+	netconfig *network.NetworkingConfig,
+	attachments []networkAttachment,
+) error {
+	cr, err := cli.ContainerCreate(ctx, cfg, hostconfig, netconfig, nil, name)
 	if err != nil {
 		return status.Errorf(codes.Internal, "unable to create Docker container: %s", err)
 	}
@@ -338,18 +740,16 @@ func (p *Platform) resourceContainerCreate(
 	state.Name = name
 
 	// Additional networks must be connected after container is created
-	if p.config.Networks != nil {
+	if len(attachments) > 0 {
 		s.Update("Connecting additional networks to container...")
-		for _, net := range p.config.Networks {
-			err = cli.NetworkConnect(ctx, net, cr.ID, &network.EndpointSettings{})
+		for _, a := range attachments {
+			err = cli.NetworkConnect(ctx, a.Network, cr.ID, a.Endpoint)
 			if err != nil {
 				s.Update("Failed to connect additional network")
-				s.Status(terminal.StatusError)
-				s.Done()
 				return status.Errorf(
 					codes.Internal,
-					"unable to connect container to additional networks: %s",
-					err)
+					"unable to connect container to additional network %q: %s",
+					a.Network, err)
 			}
 		}
 	}
@@ -359,32 +759,116 @@ func (p *Platform) resourceContainerCreate(
 	if err != nil {
 		return status.Errorf(codes.Internal, "unable to start Docker container: %s", err)
 	}
-	s.Done()
 
 	return nil
 }
 
-func (p *Platform) pullImage(cli *client.Client, log hclog.Logger, ui terminal.UI, img *docker.Image, force bool) error {
+// removeContainer stops the container gracefully and removes it. Without a
+// timeout docker sends the stop_signal and only kills the container after
+// its stop_timeout. Stopping a container that is not running does nothing,
+// and one that fails to stop is still killed by the forced remove.
+func removeContainer(ctx context.Context, cli *client.Client, id string) error {
+	err := cli.ContainerStop(ctx, id, nil)
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+
+	err = cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ownedBy reports whether the container is a deployment of the app, so a
+// redeploy may replace it. Any other container holding the app name makes
+// the create fail with a name conflict instead.
+func ownedBy(info *types.ContainerJSON, app string) bool {
+	if info.Config == nil {
+		return false
+	}
+	labels := info.Config.Labels
+	return labels["app"] == app && labels[labelId] != ""
+}
+
+// previousName is the name a previous container is kept under during a
+// blue/green redeploy with rollback_on_failure.
+func previousName(name, id string) string {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return name + "-previous-" + id
+}
+
+// restoreContainer brings a previous container back under its name.
+func restoreContainer(ctx context.Context, cli *client.Client, id, name string) error {
+	if err := cli.ContainerRename(ctx, id, name); err != nil {
+		return err
+	}
+	return cli.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+func (p *Platform) pullImage(
+	ctx context.Context,
+	cli *client.Client,
+	log hclog.Logger,
+	ui terminal.UI,
+	img *docker.Image,
+	policy string,
+) error {
 	in := fmt.Sprintf("%s:%s", img.Image, img.Tag)
-	args := filters.NewArgs()
-	args.Add("reference", in)
 
 	sg := ui.StepGroup()
 	s := sg.Add("")
 	defer func() { s.Abort() }()
 
-	// only pull if image is not in current registry so check to see if the image is present
-	// if force then skip this check
-	if force == false {
-		s.Update("Checking Docker image cache for Image " + in)
+	timeout, err := p.config.pullTimeout()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	named, err := reference.ParseNormalizedNamed(in)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "unable to parse image name: %s", in)
+	}
 
-		sum, err := cli.ImageList(context.Background(), types.ImageListOptions{Filters: args})
+	var registryAuth string
+	if p.config.Auth != nil {
+		registryAuth, err = p.config.Auth.registryAuth(named)
 		if err != nil {
-			return fmt.Errorf("unable to list images in local Docker cache: %w", err)
+			return status.Errorf(codes.Unauthenticated, "unable to get registry credentials: %s", err)
 		}
+	}
+
+	// Unless we always pull, check the local Docker image cache first
+	if policy != pullAlways {
+		s.Update("Checking Docker image cache for Image " + in)
 
-		// if we have images do not pull
-		if len(sum) > 0 {
+		local, _, err := cli.ImageInspectWithRaw(ctx, in)
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("unable to inspect image in local Docker cache: %w", err)
+		}
+		cached := err == nil
+
+		switch {
+		case !cached && policy == pullNever:
+			return status.Errorf(codes.FailedPrecondition,
+				"image %q is not in the local Docker cache and pull_policy is %q", in, pullNever)
+		case cached && policy == pullIfChanged:
+			s.Update("Comparing Docker image %q with the registry...", in)
+			changed, err := imageDigestChanged(ctx, cli, named.String(), registryAuth, local.RepoDigests)
+			if err != nil {
+				log.Warn("unable to check the registry for a newer image, using the cached image",
+					"image", in, "err", err)
+			}
+			if err != nil || !changed {
+				s.Update("Docker image %q up to date!", in)
+				s.Done()
+				return nil
+			}
+		case cached:
 			s.Update("Docker image %q up to date!", in)
 			s.Done()
 			return nil
@@ -393,44 +877,21 @@ func (p *Platform) pullImage(cli *client.Client, log hclog.Logger, ui terminal.U
 
 	s.Update("Pulling Docker Image " + in)
 
-	ipo := types.ImagePullOptions{}
+	// Pull the tag, the name alone would pull latest
+	in = named.String()
+	log.Debug("pulling image", "image", in, "timeout", timeout)
 
-	// if the username and password is not null make an authenticated
-	// image pull
-	/*
-		if image.Username != "" && image.Password != "" {
-			ipo.RegistryAuth = createRegistryAuth(image.Username, image.Password)
-		}
-	*/
-
-	named, err := reference.ParseNormalizedNamed(in)
-	if err != nil {
-		return status.Errorf(codes.InvalidArgument, "unable to parse image name: %s", in)
+	err = pullWithRetry(ctx, log, cli, s, in, types.ImagePullOptions{
+		RegistryAuth: registryAuth,
+	})
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return status.Errorf(codes.DeadlineExceeded, "pulling image %q timed out after %s", in, timeout)
 	}
-
-	in = named.Name()
-	log.Debug("pulling image", "image", in)
-
-	out, err := cli.ImagePull(context.Background(), in, ipo)
 	if err != nil {
 		return fmt.Errorf("unable to pull image: %w", err)
 	}
 
-	stdout, _, err := ui.OutputWriters()
-	if err != nil {
-		return fmt.Errorf("unable to get output writers: %s", err)
-	}
-
-	var termFd uintptr
-	if f, ok := stdout.(*os.File); ok {
-		termFd = f.Fd()
-	}
-
-	err = jsonmessage.DisplayJSONMessagesStream(out, s.TermOutput(), termFd, true, nil)
-	if err != nil {
-		return status.Errorf(codes.Internal, "unable to stream build logs to the terminal: %s", err)
-	}
-
+	s.Update("Pulled Docker Image " + in)
 	s.Done()
 
 	return nil
@@ -448,14 +909,22 @@ func (p *Platform) resourceContainerDestroy(
 		return nil
 	}
 
-	s := sg.Add("Deleting container: %s", state.Id)
+	s := sg.Add("Stopping container: %s", state.Id)
 	defer func() { s.Abort() }()
 
+	// Stop it gracefully first. Without a timeout docker sends the
+	// stop_signal and only kills the container after its stop_timeout.
+	err = cli.ContainerStop(ctx, state.Id, nil)
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+
 	// Remove it
+	s.Update("Deleting container: %s", state.Id)
 	err = cli.ContainerRemove(ctx, state.Id, types.ContainerRemoveOptions{
 		Force: true,
 	})
-	if err != nil {
+	if err != nil && !client.IsErrNotFound(err) {
 		return err
 	}
 
@@ -515,19 +984,28 @@ func (p *Platform) resourceContainerStatus(
 		}
 		containerResource.CreatedTime = timestamppb.New(containerCreatedTime)
 
-		// Figure out the resource state based on container state or health
-		if containerInfo.State.Health != nil {
+		// Figure out the resource state based on container state or health.
+		// A crash loop trumps both, docker reports the container as
+		// restarting or as stopped in between.
+		if msg, ok := crashLoop(containerInfo); ok {
+			containerResource.Health = sdk.StatusReport_DOWN
+			containerResource.HealthMessage = msg
+		} else if containerInfo.State.Health != nil {
 			// Built-in Docker health reporting
-			// NOTE: this only works if the container has configured health checks
+			// NOTE: this only works if the container has configured health checks,
+			// either through the image's HEALTHCHECK or the healthcheck block.
 
 			switch containerInfo.State.Health.Status {
-			case "Healthy":
+			case types.Healthy:
 				containerResource.Health = sdk.StatusReport_READY
 				containerResource.HealthMessage = "container is running"
-			case "Unhealthy":
+			case types.Unhealthy:
 				containerResource.Health = sdk.StatusReport_DOWN
 				containerResource.HealthMessage = "container is down"
-			case "Starting":
+				if output := lastHealthOutput(containerInfo.State.Health); output != "" {
+					containerResource.HealthMessage = "container is unhealthy: " + output
+				}
+			case types.Starting:
 				containerResource.Health = sdk.StatusReport_ALIVE
 				containerResource.HealthMessage = "container is starting"
 			default:
@@ -558,6 +1036,21 @@ func (p *Platform) resourceContainerStatus(
 			"dockerContainerInfo": containerInfo,
 		}
 
+		// Sample what the container uses, flagging usage near its limits
+		if containerInfo.State.Running {
+			usage, err := sampleUsage(ctx, cli, containerInfo)
+			if err != nil {
+				log.Warn("unable to sample container resource usage", "id", container.Id, "err", err)
+			} else {
+				containerState["resourceUsage"] = usage
+				near := usage.nearLimits()
+				if len(near) > 0 && containerResource.Health == sdk.StatusReport_READY {
+					containerResource.Health = sdk.StatusReport_PARTIAL
+					containerResource.HealthMessage = "container is near its resource limits: " + strings.Join(near, ", ")
+				}
+			}
+		}
+
 		// Pull out some useful common fields if we can
 		if containerInfo.NetworkSettings != nil {
 			if len(containerInfo.NetworkSettings.Networks) == 1 { // we should only have one network (called "waypoint")
@@ -578,74 +1071,3 @@ func (p *Platform) resourceContainerStatus(
 	s.Done()
 	return nil
 }
-
-type portField struct {
-	ContainerPort string
-	HostPort      string
-	Proto         string
-}
-
-func (pf *portField) String() string {
-	return fmt.Sprintf("ContainerPort=%s HostPort=%s Proto=%s",
-		pf.ContainerPort, pf.HostPort, pf.Proto)
-}
-
-func parsePublishPorts(portValueCSV string) ([]*portField, error) {
-	pfs := make([]*portField, 0)
-	if len(portValueCSV) == 0 {
-		return pfs, nil
-	}
-
-	tok := strings.Split(portValueCSV, ",")
-	for i := range tok {
-		pf, err := parsePublishPortField(tok[i])
-		if err != nil {
-			return nil, err
-		}
-		pfs = append(pfs, pf)
-	}
-	return pfs, nil
-}
-
-func parsePublishPortField(portValue string) (*portField, error) {
-	tok := strings.Split(portValue, ":")
-	if len(tok) == 1 {
-		containerPort, proto, err := parseProtoField(tok[0])
-		if err != nil {
-			return nil, err
-		}
-		return &portField{containerPort, "", proto}, nil
-	}
-
-	if len(tok) == 2 {
-		containerPort := tok[0]
-		hostPort, proto, err := parseProtoField(tok[1])
-		if err != nil {
-			return nil, err
-		}
-		return &portField{containerPort, hostPort, proto}, nil
-	}
-
-	return nil, fmt.Errorf("invalid port field %v", portValue)
-}
-
-func parseProtoField(v string) (port string, proto string, err error) {
-	port = ""
-	proto = "tcp"
-	err = nil
-
-	tok := strings.Split(v, "/")
-	if len(tok) == 1 {
-		port = tok[0]
-		return
-	}
-
-	if len(tok) == 2 {
-		port = tok[0]
-		proto = tok[1]
-		return
-	}
-
-	err = fmt.Errorf("invalid format. %v", v)
-	return
-}
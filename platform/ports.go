@@ -0,0 +1,175 @@
+package platform
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// publishedPorts returns the ports to publish from published_ports, publish
+// and the port blocks, validated and with ranges expanded the way docker run
+// -p does.
+func (c *PlatformConfig) publishedPorts() ([]nat.PortMapping, error) {
+	pfs, err := parsePublishPorts(c.PublishedPorts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid published_ports %q: %w", c.PublishedPorts, err)
+	}
+
+	var mappings []nat.PortMapping
+	for _, pf := range pfs {
+		ms, err := nat.ParsePortSpec(portSpec("", pf.HostPort, pf.ContainerPort, pf.Proto))
+		if err != nil {
+			return nil, fmt.Errorf("invalid published_ports entry %s: %w", pf, err)
+		}
+		mappings = append(mappings, ms...)
+	}
+
+	for _, spec := range c.Publish {
+		ms, err := nat.ParsePortSpec(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, fmt.Errorf("invalid publish entry %q: %w", spec, err)
+		}
+		mappings = append(mappings, ms...)
+	}
+
+	for i, pc := range c.Ports {
+		if pc.Container == "" {
+			return nil, fmt.Errorf("invalid port block %d: container is required", i+1)
+		}
+		ms, err := nat.ParsePortSpec(pc.portSpec())
+		if err != nil {
+			return nil, fmt.Errorf("invalid port block %d: %w", i+1, err)
+		}
+		mappings = append(mappings, ms...)
+	}
+
+	return mappings, nil
+}
+
+// portSpec returns the block in the [ip:]host:container/proto form of
+// docker run -p.
+func (pc *PortConfig) portSpec() string {
+	proto := pc.Protocol
+	if proto == "" {
+		proto = "tcp"
+	}
+	return portSpec(pc.HostIP, pc.Host, pc.Container, proto)
+}
+
+// portSpec returns a mapping in the [ip:]host:container/proto form of docker
+// run -p.
+func portSpec(hostIP, hostPort, containerPort, proto string) string {
+	spec := containerPort + "/" + proto
+	if hostPort != "" || hostIP != "" {
+		spec = hostPort + ":" + spec
+	}
+	if hostIP != "" {
+		if strings.Contains(hostIP, ":") && net.ParseIP(hostIP) != nil {
+			// IPv6 addresses need brackets to be told apart from the ports
+			hostIP = "[" + hostIP + "]"
+		}
+		spec = hostIP + ":" + spec
+	}
+	return spec
+}
+
+// unpinPortBindings returns a copy of the bindings with every host port left
+// empty, so docker assigns random host ports.
+func unpinPortBindings(bindings nat.PortMap) nat.PortMap {
+	unpinned := nat.PortMap{}
+	for port, pbs := range bindings {
+		for _, pb := range pbs {
+			unpinned[port] = append(unpinned[port], nat.PortBinding{HostIP: pb.HostIP})
+		}
+	}
+	return unpinned
+}
+
+func hasPinnedPorts(bindings nat.PortMap) bool {
+	for _, pbs := range bindings {
+		for _, pb := range pbs {
+			if pb.HostPort != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type portField struct {
+	ContainerPort string
+	HostPort      string
+	Proto         string
+}
+
+func (pf *portField) String() string {
+	return fmt.Sprintf("ContainerPort=%s HostPort=%s Proto=%s",
+		pf.ContainerPort, pf.HostPort, pf.Proto)
+}
+
+func parsePublishPorts(portValueCSV string) ([]*portField, error) {
+	pfs := make([]*portField, 0)
+	if len(portValueCSV) == 0 {
+		return pfs, nil
+	}
+
+	tok := strings.Split(portValueCSV, ",")
+	for i := range tok {
+		pf, err := parsePublishPortField(strings.TrimSpace(tok[i]))
+		if err != nil {
+			return nil, err
+		}
+		pfs = append(pfs, pf)
+	}
+	return pfs, nil
+}
+
+// parsePublishPortField parses one published_ports entry of the form
+// container[:host][/proto]. Ports can be ranges such as 8000-8010. The
+// container port comes first, the reverse of docker run -p, so entries with
+// a host IP are rejected rather than guessing the order; those go in publish.
+func parsePublishPortField(portValue string) (*portField, error) {
+	tok := strings.Split(portValue, ":")
+	if len(tok) == 1 {
+		containerPort, proto, err := parseProtoField(tok[0])
+		if err != nil {
+			return nil, err
+		}
+		return &portField{containerPort, "", proto}, nil
+	}
+
+	if len(tok) == 2 {
+		containerPort := tok[0]
+		hostPort, proto, err := parseProtoField(tok[1])
+		if err != nil {
+			return nil, err
+		}
+		return &portField{containerPort, hostPort, proto}, nil
+	}
+
+	return nil, fmt.Errorf("invalid port field %v, expected container[:host][/proto], "+
+		"use publish for the docker run -p form with a host ip", portValue)
+}
+
+func parseProtoField(v string) (port string, proto string, err error) {
+	port = ""
+	proto = "tcp"
+	err = nil
+
+	tok := strings.Split(v, "/")
+	if len(tok) == 1 {
+		port = tok[0]
+		return
+	}
+
+	if len(tok) == 2 {
+		port = tok[0]
+		proto = tok[1]
+		return
+	}
+
+	err = fmt.Errorf("invalid format. %v", v)
+	return
+}
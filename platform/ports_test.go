@@ -0,0 +1,145 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+)
+
+func TestParsePublishPortField(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    *portField
+		wantErr bool
+	}{
+		{in: "80", want: &portField{"80", "", "tcp"}},
+		{in: "53/udp", want: &portField{"53", "", "udp"}},
+		{in: "80:8080", want: &portField{"80", "8080", "tcp"}},
+		{in: "3000:3001/tcp", want: &portField{"3000", "3001", "tcp"}},
+		{in: "53:5353/udp", want: &portField{"53", "5353", "udp"}},
+		{in: "8000-8010:9000-9010", want: &portField{"8000-8010", "9000-9010", "tcp"}},
+		{in: "80:", want: &portField{"80", "", "tcp"}},
+
+		// The docker run -p form with a host ip goes in publish
+		{in: "127.0.0.1:8000:80", wantErr: true},
+		{in: "127.0.0.1::80", wantErr: true},
+		{in: "[::1]:8000:80", wantErr: true},
+		{in: "80:8080/tcp/x", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := parsePublishPortField(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPublishedPorts(t *testing.T) {
+	binding := func(port, hostIP, hostPort string) nat.PortMapping {
+		return nat.PortMapping{
+			Port:    nat.Port(port),
+			Binding: nat.PortBinding{HostIP: hostIP, HostPort: hostPort},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		config  PlatformConfig
+		want    []nat.PortMapping
+		wantErr bool
+	}{
+		{
+			name:   "published_ports maps container to host",
+			config: PlatformConfig{PublishedPorts: "80:8080, 53:5353/udp"},
+			want: []nat.PortMapping{
+				binding("80/tcp", "", "8080"),
+				binding("53/udp", "", "5353"),
+			},
+		},
+		{
+			name:   "publish maps host to container",
+			config: PlatformConfig{Publish: []string{"8080:80", "127.0.0.1:5433:5432"}},
+			want: []nat.PortMapping{
+				binding("80/tcp", "", "8080"),
+				binding("5432/tcp", "127.0.0.1", "5433"),
+			},
+		},
+		{
+			name:   "publish with a random host port",
+			config: PlatformConfig{Publish: []string{"127.0.0.1::80", "80"}},
+			want: []nat.PortMapping{
+				binding("80/tcp", "127.0.0.1", ""),
+				binding("80/tcp", "", ""),
+			},
+		},
+		{
+			name:   "publish with an ipv6 host ip",
+			config: PlatformConfig{Publish: []string{"[::1]:8080:80/tcp"}},
+			want: []nat.PortMapping{
+				binding("80/tcp", "::1", "8080"),
+			},
+		},
+		{
+			name:   "publish expands ranges",
+			config: PlatformConfig{Publish: []string{"127.0.0.1:9000-9001:8000-8001/udp"}},
+			want: []nat.PortMapping{
+				binding("8000/udp", "127.0.0.1", "9000"),
+				binding("8001/udp", "127.0.0.1", "9001"),
+			},
+		},
+		{
+			name:   "published_ports expands ranges",
+			config: PlatformConfig{PublishedPorts: "8000-8001:9000-9001"},
+			want: []nat.PortMapping{
+				binding("8000/tcp", "", "9000"),
+				binding("8001/tcp", "", "9001"),
+			},
+		},
+		{
+			name:    "publish rejects mismatched ranges",
+			config:  PlatformConfig{Publish: []string{"9000-9002:8000-8001"}},
+			wantErr: true,
+		},
+		{
+			name:    "publish rejects invalid ports",
+			config:  PlatformConfig{Publish: []string{"127.0.0.1:http:80"}},
+			wantErr: true,
+		},
+		{
+			name:    "published_ports rejects a host ip",
+			config:  PlatformConfig{PublishedPorts: "127.0.0.1:8000:80"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.config.publishedPorts()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// hostPort is a pinned host port the container is about to bind.
+type hostPort struct {
+	IP    string
+	Port  uint16
+	Proto string
+}
+
+func (hp hostPort) String() string {
+	ip := hp.IP
+	if ip == "" {
+		ip = "0.0.0.0"
+	}
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(ip, strconv.Itoa(int(hp.Port))), hp.Proto)
+}
+
+// overlaps reports whether binding ip and the host port would clash. The
+// unspecified address clashes with every other address.
+func (hp hostPort) overlaps(ip string) bool {
+	return isUnspecifiedIP(hp.IP) || isUnspecifiedIP(ip) || hp.IP == ip
+}
+
+func isUnspecifiedIP(ip string) bool {
+	return ip == "" || ip == "0.0.0.0" || ip == "::"
+}
+
+// pinnedHostPorts returns the host ports the bindings pin. Random ports and
+// dynamic host port ranges can't clash and are left out.
+func pinnedHostPorts(bindings nat.PortMap) []hostPort {
+	var pinned []hostPort
+	for port, pbs := range bindings {
+		for _, pb := range pbs {
+			if pb.HostPort == "" || strings.Contains(pb.HostPort, "-") {
+				continue
+			}
+			n, err := strconv.ParseUint(pb.HostPort, 10, 16)
+			if err != nil {
+				continue
+			}
+			pinned = append(pinned, hostPort{IP: pb.HostIP, Port: uint16(n), Proto: port.Proto()})
+		}
+	}
+	return pinned
+}
+
+// checkPortConflicts fails before anything is created when a pinned host
+// port is already taken, naming the container or local process holding it.
+// A stale deployment container of app holding a port can be stopped on the
+// spot when the terminal is interactive. The container with id exclude is
+// the one being replaced and may hold the ports.
+func (p *Platform) checkPortConflicts(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	ui terminal.UI,
+	s terminal.Step,
+	app string,
+	bindings nat.PortMap,
+	exclude string,
+) error {
+	pinned := pinnedHostPorts(bindings)
+	if len(pinned) == 0 {
+		return nil
+	}
+
+	s.Update("Checking that published host ports are free...")
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to list Docker containers: %s", err)
+	}
+
+	// Local listeners can only be probed when the daemon runs on this machine
+	probeLocal := localDaemon(cli)
+
+	var conflicts []string
+	for _, hp := range pinned {
+		if holder := containerHolding(containers, hp); holder != nil {
+			if holder.ID == exclude {
+				continue
+			}
+
+			stopped, err := p.offerStop(ctx, log, cli, ui, app, holder, hp)
+			if err != nil {
+				return err
+			}
+			if stopped {
+				continue
+			}
+
+			conflicts = append(conflicts, fmt.Sprintf("%s is used by container %s (%s)",
+				hp, containerName(holder), holder.ID[:12]))
+			continue
+		}
+
+		if probeLocal && !portFree(hp) {
+			conflicts = append(conflicts, fmt.Sprintf("%s is used by %s", hp, listenerProcess(ctx, hp)))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return status.Errorf(codes.FailedPrecondition,
+			"published host ports are already in use:\n  %s", strings.Join(conflicts, "\n  "))
+	}
+	return nil
+}
+
+// containerHolding returns the running container that publishes hp.
+func containerHolding(containers []types.Container, hp hostPort) *types.Container {
+	for i := range containers {
+		for _, port := range containers[i].Ports {
+			if port.PublicPort == hp.Port && port.Type == hp.Proto && hp.overlaps(port.IP) {
+				return &containers[i]
+			}
+		}
+	}
+	return nil
+}
+
+// offerStop asks to stop a container left over from an earlier deployment
+// of app that holds hp. Only deployment containers of the same app are
+// offered, and only when the user can answer. Containers of other apps are
+// plain conflicts.
+func (p *Platform) offerStop(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	ui terminal.UI,
+	app string,
+	holder *types.Container,
+	hp hostPort,
+) (bool, error) {
+	if holder.Labels["app"] != app || holder.Labels[labelId] == "" || !ui.Interactive() {
+		return false, nil
+	}
+
+	name := containerName(holder)
+	answer, err := ui.Input(&terminal.Input{
+		Prompt: fmt.Sprintf("Port %s is held by the stale %s deployment container %s. Stop it? [y/N]: ", hp, app, name),
+	})
+	if err != nil {
+		return false, err
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return false, nil
+	}
+
+	log.Info("stopping stale deployment container", "name", name, "id", holder.ID)
+	if err := cli.ContainerStop(ctx, holder.ID, nil); err != nil {
+		return false, status.Errorf(codes.Internal, "unable to stop container %s: %s", name, err)
+	}
+	return true, nil
+}
+
+func containerName(c *types.Container) string {
+	if len(c.Names) == 0 {
+		return c.ID[:12]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// portFree tries to bind hp on this machine.
+func portFree(hp hostPort) bool {
+	addr := net.JoinHostPort(hp.IP, strconv.Itoa(int(hp.Port)))
+	if isUnspecifiedIP(hp.IP) {
+		addr = fmt.Sprintf(":%d", hp.Port)
+	}
+
+	switch hp.Proto {
+	case "tcp":
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return false
+		}
+		l.Close()
+	case "udp":
+		c, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		c.Close()
+	}
+	return true
+}
+
+// listenerProcess names the local process listening on hp, using lsof when
+// it is available.
+func listenerProcess(ctx context.Context, hp hostPort) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	args := []string{"-nP", "-F", "pc", fmt.Sprintf("-i%s:%d", hp.Proto, hp.Port)}
+	if hp.Proto == "tcp" {
+		args = append(args, "-sTCP:LISTEN")
+	}
+	out, err := exec.CommandContext(ctx, "lsof", args...).Output()
+	if err != nil || len(out) == 0 {
+		return "another process"
+	}
+
+	// lsof -F prints one field per line, prefixed with the field name
+	var pid, command string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "p") && pid == "":
+			pid = line[1:]
+		case strings.HasPrefix(line, "c") && command == "":
+			command = line[1:]
+		}
+	}
+	if pid == "" {
+		return "another process"
+	}
+	return fmt.Sprintf("process %s (pid %s)", command, pid)
+}
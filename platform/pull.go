@@ -0,0 +1,249 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	goUnits "github.com/docker/go-units"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+)
+
+const (
+	pullAlways       = "always"
+	pullIfNotPresent = "if-not-present"
+	pullIfChanged    = "if-changed"
+	pullNever        = "never"
+
+	defaultPullTimeout = 10 * time.Minute
+
+	// A pull failing with a transient registry error is attempted this
+	// many times, waiting pullRetryDelay and then twice as long each time.
+	pullAttempts   = 4
+	pullRetryDelay = 2 * time.Second
+
+	// How often the step shows the pull progress
+	pullProgressInterval = 250 * time.Millisecond
+)
+
+// Errors that are worth retrying a pull for, as reported by the daemon
+var transientPullErrors = []string{
+	"connection reset",
+	"connection refused",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"too many requests",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+}
+
+// pullPolicy returns the pull_policy, taking force_pull into account.
+func (c *PlatformConfig) pullPolicy() string {
+	switch {
+	case c.PullPolicy != "":
+		return c.PullPolicy
+	case c.ForcePull:
+		return pullAlways
+	default:
+		return pullIfNotPresent
+	}
+}
+
+// validatePull checks the pull_policy and pull_timeout.
+func (c *PlatformConfig) validatePull() error {
+	switch c.PullPolicy {
+	case "", pullAlways, pullIfNotPresent, pullIfChanged, pullNever:
+	default:
+		return fmt.Errorf("pull_policy must be one of %q, %q, %q or %q, got %q",
+			pullAlways, pullIfNotPresent, pullIfChanged, pullNever, c.PullPolicy)
+	}
+	if c.ForcePull && c.PullPolicy != "" && c.PullPolicy != pullAlways {
+		return fmt.Errorf("force_pull conflicts with pull_policy %q", c.PullPolicy)
+	}
+
+	_, err := c.pullTimeout()
+	return err
+}
+
+func (c *PlatformConfig) pullTimeout() (time.Duration, error) {
+	if c.PullTimeout == "" {
+		return defaultPullTimeout, nil
+	}
+
+	d, err := time.ParseDuration(c.PullTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pull_timeout %q: %w", c.PullTimeout, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("pull_timeout must be positive, got %q", c.PullTimeout)
+	}
+	return d, nil
+}
+
+// imageDigestChanged reports whether the registry has a different manifest
+// for image than the one the local image was pulled from.
+func imageDigestChanged(ctx context.Context, cli *client.Client, image, registryAuth string, repoDigests []string) (bool, error) {
+	dist, err := cli.DistributionInspect(ctx, image, registryAuth)
+	if err != nil {
+		return false, err
+	}
+
+	remote := dist.Descriptor.Digest.String()
+	for _, rd := range repoDigests {
+		// Repo digests are of the form <name>@<digest>
+		if i := strings.LastIndex(rd, "@"); i >= 0 && rd[i+1:] == remote {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// pullWithRetry pulls the image, retrying transient registry errors with
+// exponential backoff.
+func pullWithRetry(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	s terminal.Step,
+	image string,
+	opts types.ImagePullOptions,
+) error {
+	delay := pullRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := pull(ctx, cli, s, image, opts)
+		if err == nil || attempt == pullAttempts || ctx.Err() != nil || !transientPullError(err) {
+			return err
+		}
+
+		log.Warn("transient error pulling image, retrying", "image", image, "attempt", attempt, "err", err)
+		s.Update("Pulling %s failed, retrying in %s: %s", image, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// pull pulls the image once, showing the progress of its layers in the step.
+func pull(ctx context.Context, cli *client.Client, s terminal.Step, image string, opts types.ImagePullOptions) error {
+	out, err := cli.ImagePull(ctx, image, opts)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	progress := newPullProgress()
+	var shown time.Time
+
+	dec := json.NewDecoder(out)
+	for {
+		var jm jsonmessage.JSONMessage
+		if err := dec.Decode(&jm); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if jm.Error != nil {
+			return jm.Error
+		}
+
+		progress.update(&jm)
+		if time.Since(shown) >= pullProgressInterval {
+			s.Update("Pulling Docker Image %s: %s", image, progress)
+			shown = time.Now()
+		}
+	}
+}
+
+func transientPullError(err error) bool {
+	if errdefs.IsUnavailable(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, t := range transientPullErrors {
+		if strings.Contains(msg, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullProgress sums up the progress of the layers of an image pull.
+type pullProgress struct {
+	layers map[string]*layerProgress
+}
+
+type layerProgress struct {
+	current, total int64
+	done           bool
+}
+
+func newPullProgress() *pullProgress {
+	return &pullProgress{layers: map[string]*layerProgress{}}
+}
+
+func (pp *pullProgress) update(jm *jsonmessage.JSONMessage) {
+	// Messages without an id, and the "Pulling from" message that carries
+	// the tag as id, are about the image rather than a layer
+	if jm.ID == "" || strings.HasPrefix(jm.Status, "Pulling from") {
+		return
+	}
+
+	l, ok := pp.layers[jm.ID]
+	if !ok {
+		l = &layerProgress{}
+		pp.layers[jm.ID] = l
+	}
+
+	switch jm.Status {
+	case "Downloading":
+		if jm.Progress != nil {
+			l.current = jm.Progress.Current
+			l.total = jm.Progress.Total
+		}
+	case "Download complete", "Verifying Checksum", "Extracting":
+		l.current = l.total
+	case "Pull complete", "Already exists":
+		l.current = l.total
+		l.done = true
+	}
+}
+
+func (pp *pullProgress) String() string {
+	var done int
+	var current, total int64
+	for _, l := range pp.layers {
+		if l.done {
+			done++
+		}
+		current += l.current
+		total += l.total
+	}
+
+	progress := fmt.Sprintf("%d/%d layers", done, len(pp.layers))
+	if total > 0 {
+		progress += fmt.Sprintf(", %s/%s", goUnits.HumanSize(float64(current)), goUnits.HumanSize(float64(total)))
+	}
+	return progress
+}
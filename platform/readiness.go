@@ -0,0 +1,425 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	probeTCP  = "tcp"
+	probeHTTP = "http"
+	probeNone = "none"
+
+	defaultReadinessTimeout  = time.Minute
+	defaultReadinessLogLines = 20
+
+	// How long the tcp probe waits for a published port to close an
+	// accepted connection. Docker's userland proxy accepts connections on
+	// the host port even when nothing listens in the container, and closes
+	// them right away once it fails to reach the container.
+	proxyCloseWait = 300 * time.Millisecond
+)
+
+// readyFunc reports whether a running container that has no docker health
+// check is ready to serve.
+type readyFunc func(ctx context.Context, info types.ContainerJSON) bool
+
+// validate checks the readiness block and fills in its defaults.
+func (r *ReadinessConfig) validate() error {
+	switch r.Probe {
+	case "":
+		r.Probe = probeTCP
+	case probeTCP, probeHTTP, probeNone:
+	default:
+		return fmt.Errorf("probe must be one of %q, %q or %q, got %q", probeTCP, probeHTTP, probeNone, r.Probe)
+	}
+
+	if _, err := r.timeout(); err != nil {
+		return err
+	}
+	if r.LogLines < 0 {
+		return fmt.Errorf("log_lines must not be negative")
+	}
+	return nil
+}
+
+func (r *ReadinessConfig) timeout() (time.Duration, error) {
+	if r.Timeout == "" {
+		return defaultReadinessTimeout, nil
+	}
+
+	d, err := time.ParseDuration(r.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", r.Timeout, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive, got %q", r.Timeout)
+	}
+	return d, nil
+}
+
+// waitForReady gates the deploy on the container becoming ready as configured
+// by the readiness block. Without a readiness block the deploy does not wait,
+// unless required is set, in which case the container must be healthy or stay
+// up for containerSettleTime. If the container does not become ready, its last
+// log lines are shown and returned in the error. netName is the network the
+// container was deployed on, which the tcp probe reaches it through.
+func (p *Platform) waitForReady(
+	ctx context.Context,
+	cli *client.Client,
+	s terminal.Step,
+	id string,
+	netName string,
+	required bool,
+) error {
+	rc := p.config.Readiness
+	if rc == nil && !required {
+		return nil
+	}
+
+	timeout := blueGreenTimeout
+	ready := settledFor(containerSettleTime)
+	logLines := defaultReadinessLogLines
+	if rc != nil {
+		if err := rc.validate(); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid readiness: %s", err)
+		}
+		timeout, _ = rc.timeout()
+		ready = readinessProbe(cli, rc, netName)
+		if rc.LogLines > 0 {
+			logLines = rc.LogLines
+		}
+	}
+
+	s.Update("Waiting up to %s for container to become ready...", timeout)
+	err := waitForContainer(ctx, cli, id, timeout, ready)
+	if err == nil {
+		return nil
+	}
+
+	logs, logErr := containerLogTail(ctx, cli, id, logLines)
+	if logErr != nil || logs == "" {
+		return status.Errorf(codes.Unavailable, "container did not become ready: %s", err)
+	}
+
+	fmt.Fprintf(s.TermOutput(), "%s\n", logs)
+	return status.Errorf(codes.Unavailable,
+		"container did not become ready: %s\n\nLast %d log lines:\n%s", err, logLines, logs)
+}
+
+// waitForContainer blocks until the container is ready. Containers with a
+// docker health check are ready once healthy, the others once ready says so.
+func waitForContainer(
+	ctx context.Context,
+	cli *client.Client,
+	id string,
+	timeout time.Duration,
+	ready readyFunc,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		info, err := cli.ContainerInspect(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("timed out after %s waiting for container to become ready", timeout)
+			}
+			return err
+		}
+
+		state := info.State
+		if msg, ok := crashLoop(info); ok {
+			return fmt.Errorf("%s", msg)
+		}
+		if !state.Running && !state.Restarting {
+			return fmt.Errorf("container exited with code %d %s", state.ExitCode, state.Error)
+		}
+		if state.Health != nil {
+			switch state.Health.Status {
+			case types.Healthy:
+				return nil
+			case types.Unhealthy:
+				if output := lastHealthOutput(state.Health); output != "" {
+					return fmt.Errorf("container is unhealthy: %s", output)
+				}
+				return fmt.Errorf("container is unhealthy")
+			}
+		} else if state.Running && ready(ctx, info) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s waiting for container to become ready", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// settledFor is ready once the container has been running for d.
+func settledFor(d time.Duration) readyFunc {
+	return func(ctx context.Context, info types.ContainerJSON) bool {
+		started, err := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+		return err == nil && time.Since(started) >= d
+	}
+}
+
+// readinessProbe probes the service_port of the container over tcp or http.
+// The tcp probe dials the container's address on netName, and falls back to
+// the published port when that address can't be reached from here, as with
+// Docker Desktop or a remote daemon. The http probe uses the published port.
+func readinessProbe(cli *client.Client, rc *ReadinessConfig, netName string) readyFunc {
+	if rc.Probe == probeNone {
+		return settledFor(containerSettleTime)
+	}
+
+	// Set once the container address could not be routed to, so the following
+	// probes go straight to the published port.
+	unreachable := false
+
+	return func(ctx context.Context, info types.ContainerJSON) bool {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+
+		if rc.Probe == probeTCP {
+			if addr, ok := containerAddr(cli, info, netName); ok && !unreachable {
+				ready, reached := probeContainer(ctx, addr)
+				if reached {
+					return ready
+				}
+				unreachable = true
+			}
+
+			addr, ok := serviceAddr(cli, info)
+			if !ok {
+				return false
+			}
+			return probePublished(ctx, addr)
+		}
+
+		addr, ok := serviceAddr(cli, info)
+		if !ok {
+			return false
+		}
+
+		path := rc.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode >= 200 && resp.StatusCode < 400
+	}
+}
+
+// probeContainer dials the container address directly. reached is false when
+// the address can't be routed to from here, in which case ready means nothing.
+func probeContainer(ctx context.Context, addr string) (ready, reached bool) {
+	d := net.Dialer{Timeout: 500 * time.Millisecond}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err == nil {
+		conn.Close()
+		return true, true
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH) {
+		return false, false
+	}
+	// Refused: the container is reachable but nothing listens yet
+	return false, true
+}
+
+// probePublished dials a published port. The connection only counts when the
+// proxy in front of it does not close it right away.
+func probePublished(ctx context.Context, addr string) bool {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(proxyCloseWait)); err != nil {
+		return false
+	}
+	_, err = conn.Read(make([]byte, 1))
+
+	// Either the service sent something, or it holds the connection open
+	// waiting for the client to speak first. EOF or a reset means the proxy
+	// could not reach the container.
+	var ne net.Error
+	return err == nil || errors.As(err, &ne) && ne.Timeout()
+}
+
+// containerAddr returns the address of the service_port on the container's
+// interface in netName. It is only used with a local daemon, the addresses of
+// a remote daemon's containers are not routable from here.
+func containerAddr(cli *client.Client, info types.ContainerJSON, netName string) (string, bool) {
+	if info.NetworkSettings == nil || !localDaemon(cli) {
+		return "", false
+	}
+
+	servicePort := ContainerServicePort(info)
+	es, ok := info.NetworkSettings.Networks[netName]
+	if !ok || es == nil || servicePort == "" {
+		return "", false
+	}
+	if es.IPAddress != "" {
+		return net.JoinHostPort(es.IPAddress, servicePort), true
+	}
+	if es.GlobalIPv6Address != "" {
+		return net.JoinHostPort(es.GlobalIPv6Address, servicePort), true
+	}
+	return "", false
+}
+
+// ContainerServicePort returns the service_port of a container the platform
+// deployed, which it sets in the PORT env var, or "" if it is not set.
+func ContainerServicePort(info types.ContainerJSON) string {
+	if info.Config == nil {
+		return ""
+	}
+
+	var servicePort string
+	for _, e := range info.Config.Env {
+		if strings.HasPrefix(e, "PORT=") {
+			servicePort = strings.TrimPrefix(e, "PORT=")
+		}
+	}
+	return servicePort
+}
+
+// serviceAddr returns the host address the service_port of the container is
+// published on. The PORT env var the platform sets holds the service_port.
+func serviceAddr(cli *client.Client, info types.ContainerJSON) (string, bool) {
+	if info.NetworkSettings == nil || info.Config == nil {
+		return "", false
+	}
+
+	servicePort := ContainerServicePort(info)
+	bindings := info.NetworkSettings.Ports[nat.Port(servicePort+"/tcp")]
+	for _, b := range bindings {
+		if b.HostPort == "" {
+			continue
+		}
+
+		host := b.HostIP
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = daemonHost(cli)
+		}
+		return net.JoinHostPort(host, b.HostPort), true
+	}
+	return "", false
+}
+
+// daemonHost is the host published ports are reachable on. That is the
+// docker host for remote daemons, and the loopback address for a daemon on a
+// local socket.
+func daemonHost(cli *client.Client) string {
+	u, err := url.Parse(cli.DaemonHost())
+	if err != nil || u.Scheme == "unix" || u.Scheme == "npipe" || u.Hostname() == "" {
+		return "127.0.0.1"
+	}
+	return u.Hostname()
+}
+
+// localDaemon reports whether the daemon runs on this machine, so its files,
+// listeners and container addresses can be reached from here. That is a
+// daemon on a local socket, or a tcp one listening on a loopback address.
+// Daemons reached over ssh are remote even when the tunnel is local.
+func localDaemon(cli *client.Client) bool {
+	u, err := url.Parse(cli.DaemonHost())
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "unix", "npipe":
+		return true
+	case "tcp", "http", "https":
+		return loopbackHost(u.Hostname())
+	default:
+		return false
+	}
+}
+
+// loopbackHost reports whether host is or only resolves to loopback addresses.
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return false
+		}
+	}
+	return true
+}
+
+// containerLogTail returns the last n lines of the container's logs.
+func containerLogTail(ctx context.Context, cli *client.Client, id string, n int) (string, error) {
+	rc, err := cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       fmt.Sprint(n),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if info.Config.Tty {
+		_, err = io.Copy(&buf, rc)
+	} else {
+		_, err = stdcopy.StdCopy(&buf, &buf, rc)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
@@ -0,0 +1,38 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+func TestLocalDaemon(t *testing.T) {
+	cases := []struct {
+		host      string
+		wantLocal bool
+		wantHost  string
+	}{
+		{host: "unix:///var/run/docker.sock", wantLocal: true, wantHost: "127.0.0.1"},
+		{host: "tcp://127.0.0.1:2375", wantLocal: true, wantHost: "127.0.0.1"},
+		{host: "tcp://localhost:2375", wantLocal: true, wantHost: "localhost"},
+		{host: "tcp://[::1]:2375", wantLocal: true, wantHost: "::1"},
+		{host: "tcp://192.0.2.10:2376", wantLocal: false, wantHost: "192.0.2.10"},
+		{host: "ssh://deploy@192.0.2.10", wantLocal: false, wantHost: "192.0.2.10"},
+		{host: "ssh://deploy@localhost", wantLocal: false, wantHost: "localhost"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.host, func(t *testing.T) {
+			cli, err := client.NewClientWithOpts(client.WithHost(tc.host))
+			if err != nil {
+				t.Fatalf("unable to create Docker client: %s", err)
+			}
+			if got := localDaemon(cli); got != tc.wantLocal {
+				t.Errorf("localDaemon = %v, want %v", got, tc.wantLocal)
+			}
+			if got := daemonHost(cli); got != tc.wantHost {
+				t.Errorf("daemonHost = %q, want %q", got, tc.wantHost)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package platform
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+// The key docker stores Docker Hub credentials under
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// validate checks that the auth block uses exactly one kind of credentials.
+func (a *AuthConfig) validate() error {
+	kinds := 0
+	if a.Username != "" || a.Password != "" {
+		if a.Username == "" || a.Password == "" {
+			return fmt.Errorf("username and password must be set together")
+		}
+		kinds++
+	}
+	if a.IdentityToken != "" {
+		kinds++
+	}
+	if a.DockerConfig {
+		kinds++
+	}
+	if kinds != 1 {
+		return fmt.Errorf("set one of username and password, identity_token or docker_config")
+	}
+	return nil
+}
+
+// registryAuth returns the credentials for pulling image, encoded for the
+// X-Registry-Auth header.
+func (a *AuthConfig) registryAuth(image reference.Named) (string, error) {
+	server := a.ServerAddress
+	if server == "" {
+		server = reference.Domain(image)
+	}
+
+	auth := types.AuthConfig{
+		Username:      a.Username,
+		Password:      a.Password,
+		IdentityToken: a.IdentityToken,
+		ServerAddress: server,
+	}
+	if a.DockerConfig {
+		var err error
+		if auth, err = dockerConfigAuth(server); err != nil {
+			return "", err
+		}
+	}
+
+	buf, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
+
+// dockerConfigAuth looks up the credentials `docker login` stored for the
+// registry server, in ~/.docker/config.json (or $DOCKER_CONFIG) and the
+// credential helpers it configures.
+func dockerConfigAuth(server string) (types.AuthConfig, error) {
+	key := server
+	if key == "docker.io" || key == "index.docker.io" {
+		key = dockerHubAuthKey
+	}
+
+	cf, err := config.Load(config.Dir())
+	if err != nil {
+		return types.AuthConfig{}, fmt.Errorf("unable to load docker config: %w", err)
+	}
+	ac, err := cf.GetAuthConfig(key)
+	if err != nil {
+		return types.AuthConfig{}, fmt.Errorf("unable to get credentials for %s from docker config: %w", server, err)
+	}
+	if ac.Username == "" && ac.IdentityToken == "" {
+		return types.AuthConfig{}, fmt.Errorf("no credentials for %s in docker config, run docker login %s", server, server)
+	}
+
+	return types.AuthConfig{
+		Username:      ac.Username,
+		Password:      ac.Password,
+		Auth:          ac.Auth,
+		ServerAddress: ac.ServerAddress,
+		IdentityToken: ac.IdentityToken,
+		RegistryToken: ac.RegistryToken,
+	}, nil
+}
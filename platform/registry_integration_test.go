@@ -0,0 +1,270 @@
+//go:build integration
+// +build integration
+
+package platform
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"github.com/hashicorp/waypoint/builtin/docker"
+)
+
+// These tests run a registry:2 container with basic auth and need a Docker
+// daemon that can pull from Docker Hub:
+//
+//	go test -tags integration -run TestPullImageRegistryAuth ./platform
+//
+// The registry only supports username and password logins. Identity tokens
+// are covered by the unit tests of registryAuth.
+
+const (
+	testRegistryUser     = "dockerdesk"
+	testRegistryPassword = "dockerdesk-secret"
+)
+
+func TestPullImageRegistryAuth(t *testing.T) {
+	ctx := context.Background()
+	cli, err := NewDockerClient(ctx, nil)
+	if err != nil {
+		t.Fatalf("unable to create Docker client: %s", err)
+	}
+
+	registry := startTestRegistry(ctx, t, cli)
+	image := registry + "/dockerdesk/busybox"
+	pushTestImage(ctx, t, cli, image+":test")
+
+	cases := []struct {
+		name    string
+		auth    *AuthConfig
+		creds   map[string]string
+		wantErr bool
+	}{
+		{
+			name: "username and password",
+			auth: &AuthConfig{Username: testRegistryUser, Password: testRegistryPassword},
+		},
+		{
+			name:  "docker config",
+			auth:  &AuthConfig{DockerConfig: true},
+			creds: map[string]string{registry: testRegistryUser + ":" + testRegistryPassword},
+		},
+		{
+			name:    "wrong password",
+			auth:    &AuthConfig{Username: testRegistryUser, Password: "wrong"},
+			wantErr: true,
+		},
+		{
+			name:    "docker config without a login",
+			auth:    &AuthConfig{DockerConfig: true},
+			creds:   map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "no credentials",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.creds != nil {
+				useDockerConfig(t, tc.creds)
+			}
+			removeTestImage(ctx, t, cli, image+":test")
+
+			p := &Platform{config: PlatformConfig{Auth: tc.auth}}
+			err := p.pullImage(ctx, cli, hclog.NewNullLogger(), terminal.NonInteractiveUI(ctx),
+				&docker.Image{Image: image, Tag: "test"}, pullAlways)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected the pull to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to pull image: %s", err)
+			}
+			if _, _, err := cli.ImageInspectWithRaw(ctx, image+":test"); err != nil {
+				t.Fatalf("pulled image is not in the local cache: %s", err)
+			}
+		})
+	}
+}
+
+// startTestRegistry starts a registry with basic auth on a random port of the
+// daemon's loopback address, which docker allows plain http for, and returns
+// its address.
+func startTestRegistry(ctx context.Context, t *testing.T, cli *client.Client) string {
+	t.Helper()
+
+	htpasswd := runTestContainer(ctx, t, cli, "httpd:2",
+		"htpasswd", "-Bbn", testRegistryUser, testRegistryPassword)
+
+	pullTestImage(ctx, t, cli, "registry:2")
+	port := nat.Port("5000/tcp")
+	cr, err := cli.ContainerCreate(ctx, &container.Config{
+		Image: "registry:2",
+		Env: []string{
+			"REGISTRY_AUTH=htpasswd",
+			"REGISTRY_AUTH_HTPASSWD_REALM=dockerdesk",
+			"REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd",
+		},
+		ExposedPorts: nat.PortSet{port: struct{}{}},
+	}, &container.HostConfig{
+		PortBindings: nat.PortMap{port: []nat.PortBinding{{HostIP: "127.0.0.1"}}},
+	}, nil, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create registry container: %s", err)
+	}
+	t.Cleanup(func() {
+		removeContainer(context.Background(), cli, cr.ID)
+	})
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "auth/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "auth/htpasswd", Mode: 0644, Size: int64(len(htpasswd))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(htpasswd)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.CopyToContainer(ctx, cr.ID, "/", &buf, types.CopyToContainerOptions{}); err != nil {
+		t.Fatalf("unable to copy htpasswd to registry container: %s", err)
+	}
+
+	if err := cli.ContainerStart(ctx, cr.ID, types.ContainerStartOptions{}); err != nil {
+		t.Fatalf("unable to start registry container: %s", err)
+	}
+
+	info, err := cli.ContainerInspect(ctx, cr.ID)
+	if err != nil {
+		t.Fatalf("unable to inspect registry container: %s", err)
+	}
+	bindings := info.NetworkSettings.Ports[port]
+	if len(bindings) == 0 {
+		t.Fatal("registry port is not published")
+	}
+	return "127.0.0.1:" + bindings[0].HostPort
+}
+
+// runTestContainer runs cmd in a container of image and returns its output.
+func runTestContainer(ctx context.Context, t *testing.T, cli *client.Client, image string, cmd ...string) string {
+	t.Helper()
+
+	pullTestImage(ctx, t, cli, image)
+	cr, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:      image,
+		Entrypoint: cmd[:1],
+		Cmd:        cmd[1:],
+	}, nil, nil, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create %s container: %s", image, err)
+	}
+	defer removeContainer(ctx, cli, cr.ID)
+
+	waitC, errC := cli.ContainerWait(ctx, cr.ID, container.WaitConditionNextExit)
+	if err := cli.ContainerStart(ctx, cr.ID, types.ContainerStartOptions{}); err != nil {
+		t.Fatalf("unable to start %s container: %s", image, err)
+	}
+	select {
+	case <-waitC:
+	case err := <-errC:
+		t.Fatalf("unable to wait for %s container: %s", image, err)
+	}
+
+	out, err := containerLogTail(ctx, cli, cr.ID, 100)
+	if err != nil {
+		t.Fatalf("unable to read %s container output: %s", image, err)
+	}
+	return strings.TrimSpace(out) + "\n"
+}
+
+// pushTestImage pushes busybox to ref with the test credentials. The push is
+// retried while the registry is starting up.
+func pushTestImage(ctx context.Context, t *testing.T, cli *client.Client, ref string) {
+	t.Helper()
+
+	pullTestImage(ctx, t, cli, "busybox:latest")
+	if err := cli.ImageTag(ctx, "busybox:latest", ref); err != nil {
+		t.Fatalf("unable to tag image: %s", err)
+	}
+	t.Cleanup(func() {
+		removeTestImage(context.Background(), t, cli, ref)
+	})
+
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &AuthConfig{Username: testRegistryUser, Password: testRegistryPassword}
+	registryAuth, err := auth.registryAuth(named)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		err = func() error {
+			out, err := cli.ImagePush(ctx, ref, types.ImagePushOptions{RegistryAuth: registryAuth})
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			return jsonmessage.DisplayJSONMessagesStream(out, io.Discard, 0, false, nil)
+		}()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unable to push %s: %s", ref, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func pullTestImage(ctx context.Context, t *testing.T, cli *client.Client, ref string) {
+	t.Helper()
+
+	if _, _, err := cli.ImageInspectWithRaw(ctx, ref); err == nil {
+		return
+	}
+	out, err := cli.ImagePull(ctx, ref, types.ImagePullOptions{})
+	if err != nil {
+		t.Fatalf("unable to pull %s: %s", ref, err)
+	}
+	defer out.Close()
+	if err := jsonmessage.DisplayJSONMessagesStream(out, io.Discard, 0, false, nil); err != nil {
+		t.Fatalf("unable to pull %s: %s", ref, err)
+	}
+}
+
+// removeTestImage removes the tag from the local cache, so the next pull has
+// to go to the registry.
+func removeTestImage(ctx context.Context, t *testing.T, cli *client.Client, ref string) {
+	t.Helper()
+
+	_, err := cli.ImageRemove(ctx, ref, types.ImageRemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		t.Fatalf("unable to remove %s: %s", ref, err)
+	}
+}
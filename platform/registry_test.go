@@ -0,0 +1,190 @@
+package platform
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+func TestAuthConfigValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		auth    AuthConfig
+		wantErr bool
+	}{
+		{name: "username and password", auth: AuthConfig{Username: "user", Password: "pass"}},
+		{name: "identity token", auth: AuthConfig{IdentityToken: "token"}},
+		{name: "docker config", auth: AuthConfig{DockerConfig: true}},
+		{name: "nothing", auth: AuthConfig{}, wantErr: true},
+		{name: "username only", auth: AuthConfig{Username: "user"}, wantErr: true},
+		{name: "password only", auth: AuthConfig{Password: "pass"}, wantErr: true},
+		{name: "two kinds", auth: AuthConfig{IdentityToken: "token", DockerConfig: true}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.auth.validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	useDockerConfig(t, map[string]string{
+		"localhost:5000":     "cfguser:cfgpass",
+		"ghcr.io":            "ghuser:ghpass",
+		"registry.local:443": "",
+	})
+
+	cases := []struct {
+		name    string
+		auth    AuthConfig
+		image   string
+		want    types.AuthConfig
+		wantErr bool
+	}{
+		{
+			name:  "username and password for the image's registry",
+			auth:  AuthConfig{Username: "user", Password: "pass"},
+			image: "localhost:5000/app:latest",
+			want:  types.AuthConfig{Username: "user", Password: "pass", ServerAddress: "localhost:5000"},
+		},
+		{
+			name:  "username and password for docker hub",
+			auth:  AuthConfig{Username: "user", Password: "pass"},
+			image: "nginx",
+			want:  types.AuthConfig{Username: "user", Password: "pass", ServerAddress: "docker.io"},
+		},
+		{
+			name:  "server_address overrides the image's registry",
+			auth:  AuthConfig{Username: "user", Password: "pass", ServerAddress: "https://registry.example.com"},
+			image: "registry.example.com/app",
+			want:  types.AuthConfig{Username: "user", Password: "pass", ServerAddress: "https://registry.example.com"},
+		},
+		{
+			name:  "identity token",
+			auth:  AuthConfig{IdentityToken: "token"},
+			image: "localhost:5000/app",
+			want:  types.AuthConfig{IdentityToken: "token", ServerAddress: "localhost:5000"},
+		},
+		{
+			name:  "docker config",
+			auth:  AuthConfig{DockerConfig: true},
+			image: "localhost:5000/app",
+			want: types.AuthConfig{
+				Username:      "cfguser",
+				Password:      "cfgpass",
+				ServerAddress: "localhost:5000",
+			},
+		},
+		{
+			name:  "docker config with server_address",
+			auth:  AuthConfig{DockerConfig: true, ServerAddress: "ghcr.io"},
+			image: "localhost:5000/app",
+			want: types.AuthConfig{
+				Username:      "ghuser",
+				Password:      "ghpass",
+				ServerAddress: "ghcr.io",
+			},
+		},
+		{
+			name:    "docker config without credentials for the registry",
+			auth:    AuthConfig{DockerConfig: true},
+			image:   "registry.local:443/app",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			named, err := reference.ParseNormalizedNamed(tc.image)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err := tc.auth.registryAuth(named)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// The header is URL safe base64 of the JSON auth config
+			buf, err := base64.URLEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatalf("registry auth is not URL safe base64: %s", err)
+			}
+			var got types.AuthConfig
+			if err := json.Unmarshal(buf, &got); err != nil {
+				t.Fatalf("registry auth is not a JSON auth config: %s", err)
+			}
+			got.Auth = ""
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDockerConfigAuthDockerHub(t *testing.T) {
+	useDockerConfig(t, map[string]string{
+		dockerHubAuthKey: "hubuser:hubpass",
+	})
+
+	for _, server := range []string{"docker.io", "index.docker.io"} {
+		t.Run(server, func(t *testing.T) {
+			ac, err := dockerConfigAuth(server)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ac.Username != "hubuser" || ac.Password != "hubpass" {
+				t.Fatalf("got %q/%q, want the docker hub credentials", ac.Username, ac.Password)
+			}
+		})
+	}
+}
+
+// useDockerConfig points the docker config at a config.json holding the
+// given user:pass credentials per registry for the duration of the test. An
+// empty value stores an entry without credentials.
+func useDockerConfig(t *testing.T, creds map[string]string) {
+	t.Helper()
+
+	auths := map[string]map[string]string{}
+	for server, userPass := range creds {
+		entry := map[string]string{}
+		if userPass != "" {
+			entry["auth"] = base64.StdEncoding.EncodeToString([]byte(userPass))
+		}
+		auths[server] = entry
+	}
+	buf, err := json.Marshal(map[string]interface{}{"auths": auths})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, config.ConfigFileName), buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := config.Dir()
+	config.SetDir(dir)
+	t.Cleanup(func() { config.SetDir(prev) })
+}
@@ -0,0 +1,110 @@
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	goUnits "github.com/docker/go-units"
+)
+
+// The keys of the resources map. Ulimits use ulimit_<name> keys.
+const (
+	resourceMemory            = "memory"
+	resourceMemoryReservation = "memory_reservation"
+	resourceMemorySwap        = "memory_swap"
+	resourceCPU               = "cpu"
+	resourceNanoCPUs          = "nano_cpus"
+	resourceCpusetCPUs        = "cpuset_cpus"
+	resourcePidsLimit         = "pids_limit"
+	resourceBlkioWeight       = "blkio_weight"
+
+	resourceUlimitPrefix = "ulimit_"
+)
+
+// A list of cpus or ranges of cpus, e.g. "0-3,6"
+var cpusetPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// resources parses the resources map. Every key is optional, unknown keys
+// are rejected.
+func (c *PlatformConfig) resources() (container.Resources, error) {
+	var resources container.Resources
+	var unknown []string
+
+	for key, value := range c.Resources {
+		var err error
+		switch key {
+		case resourceMemory:
+			resources.Memory, err = goUnits.FromHumanSize(value)
+		case resourceMemoryReservation:
+			resources.MemoryReservation, err = goUnits.FromHumanSize(value)
+		case resourceMemorySwap:
+			// -1 allows unlimited swap
+			if value == "-1" {
+				resources.MemorySwap = -1
+			} else {
+				resources.MemorySwap, err = goUnits.FromHumanSize(value)
+			}
+		case resourceCPU:
+			resources.CPUShares, err = strconv.ParseInt(value, 10, 64)
+		case resourceNanoCPUs:
+			var cpus float64
+			cpus, err = strconv.ParseFloat(value, 64)
+			if err == nil && cpus <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+			resources.NanoCPUs = int64(cpus * 1e9)
+		case resourceCpusetCPUs:
+			if !cpusetPattern.MatchString(value) {
+				err = fmt.Errorf("expected a list of cpus such as \"0-3,6\"")
+			}
+			resources.CpusetCpus = value
+		case resourcePidsLimit:
+			var limit int64
+			limit, err = strconv.ParseInt(value, 10, 64)
+			resources.PidsLimit = &limit
+		case resourceBlkioWeight:
+			var weight uint64
+			weight, err = strconv.ParseUint(value, 10, 16)
+			if err == nil && (weight < 10 || weight > 1000) {
+				err = fmt.Errorf("must be between 10 and 1000")
+			}
+			resources.BlkioWeight = uint16(weight)
+		default:
+			if !strings.HasPrefix(key, resourceUlimitPrefix) {
+				unknown = append(unknown, key)
+				continue
+			}
+
+			// ulimit_nofile = "1024:2048" sets the soft and hard limit
+			var ulimit *goUnits.Ulimit
+			ulimit, err = goUnits.ParseUlimit(strings.TrimPrefix(key, resourceUlimitPrefix) + "=" + value)
+			if err == nil {
+				resources.Ulimits = append(resources.Ulimits, ulimit)
+			}
+		}
+		if err != nil {
+			return resources, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return resources, fmt.Errorf("unknown keys %s, expected %s or %s<name>",
+			strings.Join(unknown, ", "),
+			strings.Join([]string{
+				resourceMemory, resourceMemoryReservation, resourceMemorySwap, resourceCPU,
+				resourceNanoCPUs, resourceCpusetCPUs, resourcePidsLimit, resourceBlkioWeight,
+			}, ", "),
+			resourceUlimitPrefix)
+	}
+
+	// Keep the ulimits in a stable order
+	sort.Slice(resources.Ulimits, func(i, j int) bool {
+		return resources.Ulimits[i].Name < resources.Ulimits[j].Name
+	})
+	return resources, nil
+}
@@ -0,0 +1,132 @@
+package platform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	goUnits "github.com/docker/go-units"
+)
+
+func TestResources(t *testing.T) {
+	pids := int64(256)
+
+	cases := []struct {
+		name    string
+		in      map[string]string
+		want    container.Resources
+		wantErr string
+	}{
+		{
+			name: "every key is optional",
+			in:   nil,
+			want: container.Resources{},
+		},
+		{
+			name: "all keys",
+			in: map[string]string{
+				"memory":             "512MB",
+				"memory_reservation": "256MB",
+				"memory_swap":        "1GB",
+				"cpu":                "512",
+				"nano_cpus":          "1.5",
+				"cpuset_cpus":        "0-3,6",
+				"pids_limit":         "256",
+				"blkio_weight":       "300",
+			},
+			want: container.Resources{
+				Memory:            512000000,
+				MemoryReservation: 256000000,
+				MemorySwap:        1000000000,
+				CPUShares:         512,
+				NanoCPUs:          1500000000,
+				CpusetCpus:        "0-3,6",
+				PidsLimit:         &pids,
+				BlkioWeight:       300,
+			},
+		},
+		{
+			name: "unlimited swap",
+			in:   map[string]string{"memory_swap": "-1"},
+			want: container.Resources{MemorySwap: -1},
+		},
+		{
+			name: "ulimits with soft and hard limits",
+			in:   map[string]string{"ulimit_nproc": "64", "ulimit_nofile": "1024:2048"},
+			want: container.Resources{Ulimits: []*goUnits.Ulimit{
+				{Name: "nofile", Soft: 1024, Hard: 2048},
+				{Name: "nproc", Soft: 64, Hard: 64},
+			}},
+		},
+		{
+			name:    "unknown keys are listed sorted",
+			in:      map[string]string{"swap": "1g", "cpus": "2", "memory": "1g"},
+			wantErr: "unknown keys cpus, swap,",
+		},
+		{
+			name:    "nano_cpus must be positive",
+			in:      map[string]string{"nano_cpus": "0"},
+			wantErr: "must be positive",
+		},
+		{
+			name:    "negative nano_cpus",
+			in:      map[string]string{"nano_cpus": "-1.5"},
+			wantErr: "must be positive",
+		},
+		{
+			name:    "blkio_weight below 10",
+			in:      map[string]string{"blkio_weight": "9"},
+			wantErr: "must be between 10 and 1000",
+		},
+		{
+			name: "blkio_weight at the bounds",
+			in:   map[string]string{"blkio_weight": "1000"},
+			want: container.Resources{BlkioWeight: 1000},
+		},
+		{
+			name:    "blkio_weight above 1000",
+			in:      map[string]string{"blkio_weight": "1001"},
+			wantErr: "must be between 10 and 1000",
+		},
+		{
+			name:    "ulimit soft above hard",
+			in:      map[string]string{"ulimit_nofile": "2048:1024"},
+			wantErr: "invalid ulimit_nofile",
+		},
+		{
+			name:    "invalid ulimit",
+			in:      map[string]string{"ulimit_nofile": "many"},
+			wantErr: "invalid ulimit_nofile",
+		},
+		{
+			name:    "invalid cpuset",
+			in:      map[string]string{"cpuset_cpus": "0-"},
+			wantErr: "invalid cpuset_cpus",
+		},
+		{
+			name:    "invalid memory",
+			in:      map[string]string{"memory": "lots"},
+			wantErr: "invalid memory",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := PlatformConfig{Resources: tc.in}
+			got, err := c.resources()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
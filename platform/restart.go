@@ -0,0 +1,69 @@
+package platform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	restartNo            = "no"
+	restartOnFailure     = "on-failure"
+	restartUnlessStopped = "unless-stopped"
+	restartAlways        = "always"
+)
+
+// restartPolicy parses the restart_policy, which is one of no, always,
+// unless-stopped or on-failure with an optional maximum retry count, as in
+// "on-failure:5".
+func (c *PlatformConfig) restartPolicy() (container.RestartPolicy, error) {
+	if c.RestartPolicy == "" {
+		return container.RestartPolicy{}, nil
+	}
+
+	parts := strings.SplitN(c.RestartPolicy, ":", 2)
+	policy := container.RestartPolicy{Name: parts[0]}
+	switch policy.Name {
+	case restartNo, restartUnlessStopped, restartAlways:
+		if len(parts) == 2 {
+			return policy, fmt.Errorf("a maximum retry count is only supported by %q", restartOnFailure)
+		}
+	case restartOnFailure:
+		if len(parts) == 2 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil || n < 0 {
+				return policy, fmt.Errorf("invalid maximum retry count %q", parts[1])
+			}
+			policy.MaximumRetryCount = n
+		}
+	default:
+		return policy, fmt.Errorf("restart_policy must be one of %q, %q, %q or %q, got %q",
+			restartNo, restartOnFailure, restartUnlessStopped, restartAlways, c.RestartPolicy)
+	}
+	return policy, nil
+}
+
+// crashLoop describes the crash loop of the container, if it is in one: docker
+// keeps restarting it after it exits, or gave up doing so.
+func crashLoop(info types.ContainerJSON) (string, bool) {
+	if info.State == nil || info.RestartCount == 0 || (info.State.Running && !info.State.Restarting) {
+		return "", false
+	}
+
+	msg := fmt.Sprintf("container is crash looping, restarted %d times, last exit code %d",
+		info.RestartCount, info.State.ExitCode)
+	if !info.State.Restarting {
+		msg = fmt.Sprintf("container stopped after %d restarts, last exit code %d",
+			info.RestartCount, info.State.ExitCode)
+	}
+	if info.State.Error != "" {
+		msg += ": " + info.State.Error
+	}
+	if info.State.OOMKilled {
+		msg += " (out of memory)"
+	}
+	return msg, true
+}
@@ -0,0 +1,52 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestRestartPolicy(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    container.RestartPolicy
+		wantErr bool
+	}{
+		{in: "", want: container.RestartPolicy{}},
+		{in: "no", want: container.RestartPolicy{Name: "no"}},
+		{in: "always", want: container.RestartPolicy{Name: "always"}},
+		{in: "unless-stopped", want: container.RestartPolicy{Name: "unless-stopped"}},
+		{in: "on-failure", want: container.RestartPolicy{Name: "on-failure"}},
+		{in: "on-failure:5", want: container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 5}},
+		{in: "on-failure:0", want: container.RestartPolicy{Name: "on-failure"}},
+
+		{in: "on-failure:-1", wantErr: true},
+		{in: "on-failure:many", wantErr: true},
+		{in: "on-failure:", wantErr: true},
+		{in: "always:3", wantErr: true},
+		{in: "unless-stopped:3", wantErr: true},
+		{in: "no:1", wantErr: true},
+		{in: "sometimes", wantErr: true},
+		{in: "Always", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			c := PlatformConfig{RestartPolicy: tc.in}
+			got, err := c.restartPolicy()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	goUnits "github.com/docker/go-units"
+)
+
+// Usage at or above this fraction of a limit is reported as near the limit
+const usageWarnThreshold = 0.9
+
+// containerUsage is a sample of the resources a container uses.
+type containerUsage struct {
+	// CPU usage in percent of a single CPU, as docker stats reports it, and
+	// the number of CPUs the container may use.
+	CPUPercent float64 `json:"cpuPercent"`
+	CPULimit   float64 `json:"cpuLimit"`
+
+	MemoryUsage   uint64  `json:"memoryUsage"`
+	MemoryLimit   uint64  `json:"memoryLimit"`
+	MemoryPercent float64 `json:"memoryPercent"`
+
+	NetworkRxBytes uint64 `json:"networkRxBytes"`
+	NetworkTxBytes uint64 `json:"networkTxBytes"`
+
+	BlockReadBytes  uint64 `json:"blockReadBytes"`
+	BlockWriteBytes uint64 `json:"blockWriteBytes"`
+
+	Pids      uint64 `json:"pids"`
+	PidsLimit uint64 `json:"pidsLimit,omitempty"`
+}
+
+// sampleUsage takes a single stats sample of the running container.
+func sampleUsage(ctx context.Context, cli *client.Client, info types.ContainerJSON) (*containerUsage, error) {
+	resp, err := cli.ContainerStats(ctx, info.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("unable to decode container stats: %w", err)
+	}
+
+	usage := &containerUsage{
+		MemoryLimit: stats.MemoryStats.Limit,
+		Pids:        stats.PidsStats.Current,
+		PidsLimit:   stats.PidsStats.Limit,
+	}
+
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		usage.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+	usage.CPULimit = onlineCPUs
+	if info.HostConfig != nil && info.HostConfig.NanoCPUs > 0 {
+		usage.CPULimit = float64(info.HostConfig.NanoCPUs) / 1e9
+	}
+
+	// Page cache counts towards the usage but is freed under pressure, so
+	// leave it out like docker stats does. cgroup v1 reports it as cache,
+	// v2 as inactive_file.
+	usage.MemoryUsage = stats.MemoryStats.Usage
+	for _, key := range []string{"total_inactive_file", "inactive_file", "cache"} {
+		if v, ok := stats.MemoryStats.Stats[key]; ok && v < usage.MemoryUsage {
+			usage.MemoryUsage -= v
+			break
+		}
+	}
+	if usage.MemoryLimit > 0 {
+		usage.MemoryPercent = float64(usage.MemoryUsage) / float64(usage.MemoryLimit) * 100
+	}
+
+	for _, n := range stats.Networks {
+		usage.NetworkRxBytes += n.RxBytes
+		usage.NetworkTxBytes += n.TxBytes
+	}
+	for _, e := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			usage.BlockReadBytes += e.Value
+		case "write":
+			usage.BlockWriteBytes += e.Value
+		}
+	}
+
+	return usage, nil
+}
+
+// nearLimits describes the limits the usage is close to.
+func (u *containerUsage) nearLimits() []string {
+	var near []string
+	if u.CPULimit > 0 && u.CPUPercent/100 >= u.CPULimit*usageWarnThreshold {
+		near = append(near, fmt.Sprintf("cpu at %.0f%% of %g CPUs", u.CPUPercent, u.CPULimit))
+	}
+	if u.MemoryLimit > 0 && u.MemoryPercent >= usageWarnThreshold*100 {
+		near = append(near, fmt.Sprintf("memory at %.0f%% of %s",
+			u.MemoryPercent, goUnits.BytesSize(float64(u.MemoryLimit))))
+	}
+	if u.PidsLimit > 0 && float64(u.Pids) >= float64(u.PidsLimit)*usageWarnThreshold {
+		near = append(near, fmt.Sprintf("%d of %d pids", u.Pids, u.PidsLimit))
+	}
+	return near
+}
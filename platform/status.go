@@ -46,19 +46,25 @@ func (p *Platform) Status(
 		}); err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to manually set container resource state while restoring from an old deployment: %s", err)
 		}
-		if err := rm.Resource("network").SetState(&docker.Resource_Network{
-			Name: "waypoint",
+		if err := rm.Resource("network").SetState(&Resource_Network{
+			Name: defaultNetworkName,
 		}); err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to manually set network resource state while restoring from an old deployment: %s", err)
 		}
 	} else {
 		// Load our set state
-		if err := rm.LoadState(deployment.ResourceState); err != nil {
+		if err := loadState(rm, deployment.ResourceState); err != nil {
 			return nil, status.Errorf(codes.Internal, "resource manager failed to load state: %s", err)
 		}
 	}
 
-	result, err := rm.StatusReport(ctx, log, sg, cli, ui)
+	// The network status checks that the deployment's container is attached
+	deployed := &deployedContainer{}
+	if c, ok := rm.Resource("container").State().(*docker.Resource_Container); ok && c != nil {
+		deployed.Id = c.Id
+	}
+
+	result, err := rm.StatusReport(ctx, log, sg, cli, ui, deployed)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "resource manager failed to generate resource statuses: %s", err)
 	}
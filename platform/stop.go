@@ -0,0 +1,36 @@
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// A signal name such as SIGTERM or TERM, or a signal number
+var stopSignalPattern = regexp.MustCompile(`^((SIG)?[A-Z][A-Z0-9+-]*|[0-9]+)$`)
+
+// setStop sets the stop_signal and stop_timeout on the container config.
+// Docker uses them whenever the container is stopped.
+func (c *PlatformConfig) setStop(cfg *container.Config) error {
+	if c.StopSignal != "" {
+		if !stopSignalPattern.MatchString(c.StopSignal) {
+			return fmt.Errorf("invalid stop_signal %q", c.StopSignal)
+		}
+		cfg.StopSignal = c.StopSignal
+	}
+
+	if c.StopTimeout != "" {
+		d, err := time.ParseDuration(c.StopTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid stop_timeout %q: %w", c.StopTimeout, err)
+		}
+		if d < 0 || d%time.Second != 0 {
+			return fmt.Errorf("stop_timeout must be a whole number of seconds, got %q", c.StopTimeout)
+		}
+		seconds := int(d / time.Second)
+		cfg.StopTimeout = &seconds
+	}
+	return nil
+}
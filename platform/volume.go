@@ -0,0 +1,367 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	goUnits "github.com/docker/go-units"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultVolumeDriver = "local"
+
+	volumeRetain = "retain"
+	volumeRemove = "remove"
+
+	defaultScratchPath = "/input"
+
+	scratchVolume = "volume"
+	scratchTmpfs  = "tmpfs"
+	scratchNone   = "none"
+)
+
+// validateVolumes checks the volume blocks.
+func (c *PlatformConfig) validateVolumes() error {
+	names := map[string]bool{}
+	paths := map[string]bool{}
+	for _, v := range c.Volumes {
+		if v.Name == "" {
+			return fmt.Errorf("invalid volume: name must not be empty")
+		}
+		if names[v.Name] {
+			return fmt.Errorf("invalid volume %q: volume is declared twice", v.Name)
+		}
+		names[v.Name] = true
+
+		if !path.IsAbs(v.Path) {
+			return fmt.Errorf("invalid volume %q: path must be absolute, got %q", v.Name, v.Path)
+		}
+		if paths[path.Clean(v.Path)] {
+			return fmt.Errorf("invalid volume %q: another volume is mounted at %s", v.Name, v.Path)
+		}
+		paths[path.Clean(v.Path)] = true
+
+		switch v.OnDestroy {
+		case "", volumeRetain, volumeRemove:
+		default:
+			return fmt.Errorf("invalid volume %q: on_destroy must be %q or %q, got %q",
+				v.Name, volumeRetain, volumeRemove, v.OnDestroy)
+		}
+	}
+	return nil
+}
+
+// validateScratch checks the scratch settings, including that no volume is
+// mounted at the scratch path.
+func (c *PlatformConfig) validateScratch() error {
+	switch c.ScratchType {
+	case "", scratchVolume, scratchTmpfs, scratchNone:
+	default:
+		return fmt.Errorf("scratch_type must be one of %q, %q or %q, got %q",
+			scratchVolume, scratchTmpfs, scratchNone, c.ScratchType)
+	}
+	if c.ScratchType == scratchNone {
+		return nil
+	}
+
+	if _, err := c.scratchSize(); err != nil {
+		return err
+	}
+	if c.ScratchSize != "" && c.ScratchType != scratchTmpfs {
+		return fmt.Errorf("scratch_size requires scratch_type %q", scratchTmpfs)
+	}
+
+	target := c.scratchPath()
+	if !path.IsAbs(target) {
+		return fmt.Errorf("scratch_path must be absolute, got %q", target)
+	}
+	for _, v := range c.Volumes {
+		if path.Clean(v.Path) == path.Clean(target) {
+			return fmt.Errorf("volume %q is mounted at the scratch path %s", v.Name, target)
+		}
+	}
+	return nil
+}
+
+func (c *PlatformConfig) scratchPath() string {
+	if c.ScratchSpace == "" {
+		return defaultScratchPath
+	}
+	return c.ScratchSpace
+}
+
+func (c *PlatformConfig) scratchSize() (int64, error) {
+	if c.ScratchSize == "" {
+		return 0, nil
+	}
+	size, err := goUnits.RAMInBytes(c.ScratchSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid scratch_size %q: %w", c.ScratchSize, err)
+	}
+	return size, nil
+}
+
+// scratchMount returns the mount of the scratch directory, or nil if it is
+// disabled.
+func (c *PlatformConfig) scratchMount(app string) (*mount.Mount, error) {
+	switch c.ScratchType {
+	case scratchNone:
+		return nil, nil
+	case scratchTmpfs:
+		size, err := c.scratchSize()
+		if err != nil {
+			return nil, err
+		}
+		return &mount.Mount{
+			Type:   mount.TypeTmpfs,
+			Target: c.scratchPath(),
+			TmpfsOptions: &mount.TmpfsOptions{
+				SizeBytes: size,
+			},
+		}, nil
+	default:
+		return &mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: scratchVolumeName(app),
+			Target: c.scratchPath(),
+		}, nil
+	}
+}
+
+// scratchVolumeName is the volume backing the scratch directory. It is shared
+// by all deployments of the app.
+func scratchVolumeName(app string) string {
+	return app + "-scratch"
+}
+
+func (v *VolumeConfig) driver() string {
+	if v.Driver == "" {
+		return defaultVolumeDriver
+	}
+	return v.Driver
+}
+
+// volumeMounts returns the mounts of the volume blocks.
+func (c *PlatformConfig) volumeMounts() []mount.Mount {
+	var mounts []mount.Mount
+	for _, v := range c.Volumes {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   v.Name,
+			Target:   v.Path,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+	return mounts
+}
+
+// sharedVolumes returns the named volumes the mounts write to. Two containers
+// of the app must not run side by side on them. The scratch volume is left
+// out, it only holds input for the app.
+func sharedVolumes(mounts []mount.Mount) []string {
+	var names []string
+	for _, m := range mounts {
+		if m.Type == mount.TypeVolume && m.Source != "" && !m.ReadOnly {
+			names = append(names, m.Source)
+		}
+	}
+	return names
+}
+
+func (p *Platform) resourceVolumeCreate(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	src *component.Source,
+	job *component.JobInfo,
+	sg terminal.StepGroup,
+	state *Resource_Volumes,
+) error {
+	scratch := p.config.ScratchType == "" || p.config.ScratchType == scratchVolume
+	if len(p.config.Volumes) == 0 && !scratch {
+		return nil
+	}
+
+	s := sg.Add("Setting up volumes...")
+	defer func() { s.Abort() }()
+
+	labels := map[string]string{
+		"app":       src.App,
+		"workspace": job.Workspace,
+	}
+
+	for _, v := range p.config.Volumes {
+		created, err := ensureVolume(ctx, log, cli, s, v.Name, v.driver(), v.Options, labels)
+		if err != nil {
+			return err
+		}
+
+		// Only a volume this deployment created may be removed with it.
+		// An existing one can hold data of earlier deployments, and would
+		// otherwise be removed when a failed deploy is rolled back.
+		state.Volumes = append(state.Volumes, &Resource_Volume{
+			Name:            v.Name,
+			Driver:          v.driver(),
+			RemoveOnDestroy: created && v.OnDestroy == volumeRemove,
+		})
+	}
+
+	if scratch {
+		name := scratchVolumeName(src.App)
+		if _, err := ensureVolume(ctx, log, cli, s, name, defaultVolumeDriver, nil, labels); err != nil {
+			return err
+		}
+
+		// The scratch directory holds nothing worth keeping. It is removed
+		// once no container of the app uses it anymore.
+		state.Volumes = append(state.Volumes, &Resource_Volume{
+			Name:            name,
+			Driver:          defaultVolumeDriver,
+			RemoveOnDestroy: true,
+		})
+	}
+
+	s.Update("Using %d volume(s)", len(state.Volumes))
+	s.Done()
+	return nil
+}
+
+// ensureVolume creates the volume unless it exists already, in which case it
+// must use driver. created reports whether the volume was created.
+func ensureVolume(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	s terminal.Step,
+	name string,
+	driver string,
+	opts map[string]string,
+	labels map[string]string,
+) (created bool, err error) {
+	existing, err := cli.VolumeInspect(ctx, name)
+	switch {
+	case err == nil:
+		if existing.Driver != driver {
+			return false, status.Errorf(codes.FailedPrecondition,
+				"Docker volume %q exists with driver %q, expected %q", name, existing.Driver, driver)
+		}
+		log.Debug("using existing volume", "name", name)
+		return false, nil
+	case client.IsErrNotFound(err):
+		s.Update("Creating volume %s...", name)
+		_, err = cli.VolumeCreate(ctx, volume.VolumeCreateBody{
+			Name:       name,
+			Driver:     driver,
+			DriverOpts: opts,
+			Labels:     labels,
+		})
+		if err != nil {
+			return false, status.Errorf(codes.FailedPrecondition, "unable to create Docker volume %q: %s", name, err)
+		}
+		return true, nil
+	default:
+		return false, status.Errorf(codes.FailedPrecondition, "unable to inspect Docker volume %q: %s", name, err)
+	}
+}
+
+func (p *Platform) resourceVolumeDestroy(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	sg terminal.StepGroup,
+	state *Resource_Volumes,
+) error {
+	for _, v := range state.Volumes {
+		if !v.RemoveOnDestroy {
+			log.Debug("retaining volume", "name", v.Name)
+			continue
+		}
+
+		s := sg.Add("Deleting volume: %s", v.Name)
+		err := cli.VolumeRemove(ctx, v.Name, false)
+		switch {
+		case err == nil, client.IsErrNotFound(err):
+			s.Done()
+		case errdefs.IsConflict(err):
+			// A newer deployment of the app still mounts it
+			s.Update("Volume %s is still in use, retaining it", v.Name)
+			s.Done()
+		default:
+			s.Abort()
+			return status.Errorf(codes.Internal, "unable to remove Docker volume %q: %s", v.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *Platform) resourceVolumeStatus(
+	ctx context.Context,
+	log hclog.Logger,
+	sg terminal.StepGroup,
+	cli *client.Client,
+	state *Resource_Volumes,
+	sr *resource.StatusResponse,
+) error {
+	if len(state.Volumes) == 0 {
+		return nil
+	}
+
+	s := sg.Add("Checking status of the Docker volume resources...")
+	defer s.Abort()
+
+	for _, v := range state.Volumes {
+		log.Debug("querying docker for volume status", "name", v.Name)
+
+		vol, err := cli.VolumeInspect(ctx, v.Name)
+		if client.IsErrNotFound(err) {
+			sr.Resources = append(sr.Resources, &sdk.StatusReport_Resource{
+				Name:                v.Name,
+				CategoryDisplayHint: sdk.ResourceCategoryDisplayHint_STORAGE,
+				Health:              sdk.StatusReport_MISSING,
+			})
+			continue
+		}
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "unable to inspect Docker volume %q: %s", v.Name, err)
+		}
+
+		volJson, err := json.Marshal(map[string]interface{}{
+			"dockerVolume": vol,
+		})
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "failed to marshal docker volume status for volume %q: %s", v.Name, err)
+		}
+
+		report := &sdk.StatusReport_Resource{
+			Name:                vol.Name,
+			Id:                  vol.Name,
+			CategoryDisplayHint: sdk.ResourceCategoryDisplayHint_STORAGE,
+			Health:              sdk.StatusReport_READY, // A volume that exists can be mounted.
+			HealthMessage:       fmt.Sprintf("%s volume exists", vol.Driver),
+			StateJson:           string(volJson),
+		}
+		if created, err := time.Parse(time.RFC3339, vol.CreatedAt); err == nil {
+			report.CreatedTime = timestamppb.New(created)
+		}
+		sr.Resources = append(sr.Resources, report)
+	}
+
+	s.Update("Finished building report for Docker volume resources")
+	s.Done()
+	return nil
+}
@@ -0,0 +1,360 @@
+package release
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	protocolHTTP = "http"
+	protocolTCP  = "tcp"
+
+	defaultProxyImage = "nginx:alpine"
+
+	// The port nginx listens on inside the proxy container
+	proxyListenPort = 80
+
+	nginxConfDir  = "/etc/nginx"
+	nginxConf     = "nginx.conf"
+	nginxNextConf = "dockerdesk.next.conf"
+
+	// Every generated config starts with this marker followed by the
+	// id of the deployment it routes to.
+	deploymentMarker = "# deployment: "
+
+	labelRelease = "dockerdesk.release"
+
+	// Docker's embedded DNS server, available on user defined networks.
+	// nginx resolves the upstream through it at request time, so the
+	// release follows the container when its address changes.
+	dockerResolver = "127.0.0.11"
+)
+
+var nginxTemplate = template.Must(template.New("nginx").Parse(`# deployment: {{.DeploymentId}}
+worker_processes auto;
+
+events {
+    worker_connections 1024;
+}
+{{if eq .Protocol "tcp"}}
+stream {
+    resolver {{.Resolver}} valid=5s;
+
+    map $remote_addr $upstream {
+        default {{.Upstream}};
+    }
+
+    server {
+        listen {{.ListenPort}};
+        proxy_pass $upstream;
+    }
+}
+{{else}}
+http {
+    resolver {{.Resolver}} valid=5s;
+
+    map $http_upgrade $connection_upgrade {
+        default upgrade;
+        ''      close;
+    }
+
+    server {
+        listen {{.ListenPort}} default_server;
+        server_name {{.Hostname}};
+
+        location / {
+            set $upstream {{.Upstream}};
+            proxy_pass http://$upstream;
+            proxy_http_version 1.1;
+            proxy_set_header Host $host;
+            proxy_set_header Upgrade $http_upgrade;
+            proxy_set_header Connection $connection_upgrade;
+            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+            proxy_set_header X-Forwarded-Proto $scheme;
+        }
+    }
+}
+{{end}}`))
+
+// proxyContainer is the long running nginx container that holds the stable
+// host port of a release and forwards it to the released deployment.
+type proxyContainer struct {
+	cli      *client.Client
+	config   *ReleaseConfig
+	id       string
+	name     string
+	running  bool
+	networks map[string]bool
+}
+
+// proxy returns the proxy container of the app in the workspace, creating it
+// if it does not exist yet. A proxy whose published port or image no longer
+// matches the config is recreated.
+func (rm *ReleaseManager) proxy(
+	ctx context.Context,
+	log hclog.Logger,
+	cli *client.Client,
+	app string,
+	workspace string,
+	netName string,
+) (*proxyContainer, error) {
+	name := app + "-" + workspace + "-proxy"
+	port := nat.Port(fmt.Sprintf("%d/tcp", proxyListenPort))
+	hostPort := fmt.Sprint(rm.config.Port)
+
+	info, err := cli.ContainerInspect(ctx, name)
+	if err == nil {
+		bindings := info.HostConfig.PortBindings[port]
+		if len(bindings) == 1 &&
+			bindings[0].HostPort == hostPort &&
+			bindings[0].HostIP == rm.config.HostIP &&
+			info.Config.Image == rm.config.Image {
+			p := &proxyContainer{
+				cli:      cli,
+				config:   &rm.config,
+				id:       info.ID,
+				name:     name,
+				running:  info.State != nil && info.State.Running,
+				networks: map[string]bool{},
+			}
+			if info.NetworkSettings != nil {
+				for n := range info.NetworkSettings.Networks {
+					p.networks[n] = true
+				}
+			}
+			return p, nil
+		}
+
+		log.Info("release settings changed, recreating proxy container", "name", name)
+		if err := removeProxy(ctx, cli, info.ID); err != nil {
+			return nil, err
+		}
+	} else if !client.IsErrNotFound(err) {
+		return nil, status.Errorf(codes.Internal, "unable to inspect proxy container %q: %s", name, err)
+	}
+
+	if err := pullIfMissing(ctx, log, cli, rm.config.Image); err != nil {
+		return nil, err
+	}
+
+	cfg := container.Config{
+		Image:        rm.config.Image,
+		ExposedPorts: nat.PortSet{port: struct{}{}},
+		Labels: map[string]string{
+			labelRelease: app,
+			"app":        app,
+			"workspace":  workspace,
+		},
+	}
+	hostconfig := container.HostConfig{
+		PortBindings: nat.PortMap{
+			port: []nat.PortBinding{
+				{
+					HostIP:   rm.config.HostIP,
+					HostPort: hostPort,
+				},
+			},
+		},
+		// The proxy outlives individual deployments, keep it up across
+		// daemon restarts.
+		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+	}
+	netconfig := network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			netName: {},
+		},
+	}
+
+	cr, err := cli.ContainerCreate(ctx, &cfg, &hostconfig, &netconfig, nil, name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to create proxy container: %s", err)
+	}
+
+	return &proxyContainer{
+		cli:      cli,
+		config:   &rm.config,
+		id:       cr.ID,
+		name:     name,
+		networks: map[string]bool{netName: true},
+	}, nil
+}
+
+// route points the proxy at upstream. A running proxy validates the new
+// config and reloads nginx gracefully, so in-flight requests finish on the
+// old deployment while new ones go to the new deployment.
+func (p *proxyContainer) route(ctx context.Context, netName, upstream, deploymentId string) error {
+	if !p.networks[netName] {
+		if err := p.cli.NetworkConnect(ctx, netName, p.id, &network.EndpointSettings{}); err != nil {
+			return status.Errorf(codes.Internal,
+				"unable to connect proxy container to network %q: %s", netName, err)
+		}
+		p.networks[netName] = true
+	}
+
+	var conf bytes.Buffer
+	err := nginxTemplate.Execute(&conf, map[string]interface{}{
+		"DeploymentId": deploymentId,
+		"Protocol":     p.config.Protocol,
+		"ListenPort":   proxyListenPort,
+		"Hostname":     p.config.Hostname,
+		"Upstream":     upstream,
+		"Resolver":     dockerResolver,
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to render proxy config: %s", err)
+	}
+
+	if !p.running {
+		if err := p.copyFile(ctx, nginxConf, conf.Bytes()); err != nil {
+			return err
+		}
+		if err := p.cli.ContainerStart(ctx, p.id, types.ContainerStartOptions{}); err != nil {
+			return status.Errorf(codes.Internal, "unable to start proxy container: %s", err)
+		}
+		p.running = true
+		return nil
+	}
+
+	next := nginxConfDir + "/" + nginxNextConf
+	if err := p.copyFile(ctx, nginxNextConf, conf.Bytes()); err != nil {
+		return err
+	}
+	if err := p.exec(ctx, "nginx", "-t", "-q", "-c", next); err != nil {
+		return status.Errorf(codes.Internal, "proxy rejected the new config: %s", err)
+	}
+	if err := p.exec(ctx, "mv", "-f", next, nginxConfDir+"/"+nginxConf); err != nil {
+		return status.Errorf(codes.Internal, "unable to install the new proxy config: %s", err)
+	}
+	if err := p.exec(ctx, "nginx", "-s", "reload"); err != nil {
+		return status.Errorf(codes.Internal, "unable to reload the proxy: %s", err)
+	}
+	return nil
+}
+
+// copyFile writes data to name in the nginx config directory of the proxy.
+func (p *proxyContainer) copyFile(ctx context.Context, name string, data []byte) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	err := p.cli.CopyToContainer(ctx, p.id, nginxConfDir, &buf, types.CopyToContainerOptions{})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to copy %s to proxy container: %s", name, err)
+	}
+	return nil
+}
+
+// exec runs cmd in the proxy container and returns an error carrying its
+// output if it exits non-zero.
+func (p *proxyContainer) exec(ctx context.Context, cmd ...string) error {
+	ex, err := p.cli.ContainerExecCreate(ctx, p.id, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.cli.ContainerExecAttach(ctx, ex.ID, types.ExecStartCheck{})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, resp.Reader); err != nil {
+		return err
+	}
+
+	inspect, err := p.cli.ContainerExecInspect(ctx, ex.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("%s exited with code %d: %s",
+			strings.Join(cmd, " "), inspect.ExitCode, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+// routedDeployment reads back the id of the deployment the proxy container
+// currently routes to.
+func routedDeployment(ctx context.Context, cli *client.Client, id string) (string, error) {
+	rc, _, err := cli.CopyFromContainer(ctx, id, nginxConfDir+"/"+nginxConf)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	if _, err := tr.Next(); err != nil {
+		return "", fmt.Errorf("unable to read proxy config: %w", err)
+	}
+
+	sc := bufio.NewScanner(tr)
+	for sc.Scan() {
+		if line := sc.Text(); strings.HasPrefix(line, deploymentMarker) {
+			return strings.TrimPrefix(line, deploymentMarker), nil
+		}
+	}
+	return "", sc.Err()
+}
+
+func removeProxy(ctx context.Context, cli *client.Client, id string) error {
+	err := cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{
+		Force: true,
+	})
+	if err != nil && !client.IsErrNotFound(err) {
+		return status.Errorf(codes.Internal, "unable to remove proxy container: %s", err)
+	}
+	return nil
+}
+
+func pullIfMissing(ctx context.Context, log hclog.Logger, cli *client.Client, image string) error {
+	_, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return status.Errorf(codes.Internal, "unable to inspect proxy image %q: %s", image, err)
+	}
+
+	log.Debug("pulling proxy image", "image", image)
+	out, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to pull proxy image %q: %s", image, err)
+	}
+	defer out.Close()
+
+	_, err = io.Copy(io.Discard, out)
+	return err
+}
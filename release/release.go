@@ -0,0 +1,264 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/1xyz/dockerdesk/platform"
+	"github.com/docker/docker/client"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"github.com/hashicorp/waypoint/builtin/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReleaseConfig is the configuration structure for the ReleaseManager.
+type ReleaseConfig struct {
+	// ClientConfig selects the Docker engine the proxy runs on. It must
+	// point at the same engine as the platform's client_config, and like
+	// it defaults to the DOCKER_* env vars.
+	ClientConfig *platform.ClientConfig `hcl:"client_config,block"`
+
+	// Port on the host that the proxy listens on. This stays the same
+	// across releases, so it can be bookmarked. Defaults to 8080.
+	Port uint `hcl:"port,optional"`
+
+	// Host IP to publish the proxy port on. Defaults to all interfaces,
+	// set to 127.0.0.1 to keep the release local to this machine.
+	HostIP string `hcl:"host_ip,optional"`
+
+	// Hostname the release is served under. It is used as the proxy's
+	// server_name and in the release URL. Defaults to localhost.
+	Hostname string `hcl:"hostname,optional"`
+
+	// Port inside the deployed container to route traffic to. Defaults
+	// to the service_port the app was deployed with.
+	TargetPort uint `hcl:"target_port,optional"`
+
+	// Protocol to proxy, either "http" or "tcp". Use tcp for non-HTTP
+	// services such as databases. Defaults to http.
+	Protocol string `hcl:"protocol,optional"`
+
+	// Image used to run the proxy container. Defaults to nginx:alpine.
+	Image string `hcl:"image,optional"`
+}
+
+type ReleaseManager struct {
+	config ReleaseConfig
+}
+
+// Implement Configurable
+func (rm *ReleaseManager) Config() (interface{}, error) {
+	return &rm.config, nil
+}
+
+// Implement ConfigurableNotify
+func (rm *ReleaseManager) ConfigSet(config interface{}) error {
+	c, ok := config.(*ReleaseConfig)
+	if !ok {
+		// The Waypoint SDK should ensure this never gets hit
+		return fmt.Errorf("expected *ReleaseConfig as parameter")
+	}
+
+	switch c.Protocol {
+	case "", protocolHTTP, protocolTCP:
+	default:
+		return fmt.Errorf("protocol must be %q or %q, got %q", protocolHTTP, protocolTCP, c.Protocol)
+	}
+
+	return nil
+}
+
+// Implement Release
+func (rm *ReleaseManager) ReleaseFunc() interface{} {
+	// return a function which will be called by Waypoint
+	return rm.release
+}
+
+// Implement Destroyer
+func (rm *ReleaseManager) DestroyFunc() interface{} {
+	return rm.destroy
+}
+
+// URL implements component.Release
+func (r *Release) URL() string {
+	return r.Url
+}
+
+// A ReleaseFunc does not have a strict signature, you can define the parameters
+// you need based on the Available parameters that the Waypoint SDK provides.
+// Waypoint will automatically inject parameters as specified
+// in the signature at run time.
+//
+// In addition to default input parameters the docker.Deployment from the
+// platform is injected as the release target.
+func (rm *ReleaseManager) release(
+	ctx context.Context,
+	log hclog.Logger,
+	src *component.Source,
+	job *component.JobInfo,
+	ui terminal.UI,
+	target *docker.Deployment,
+) (*Release, error) {
+	sg := ui.StepGroup()
+	defer sg.Wait()
+
+	rm.setDefaults()
+
+	cli, err := platform.NewDockerClient(ctx, rm.config.ClientConfig)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to create Docker client: %s", err)
+	}
+
+	s := sg.Add("Resolving deployment %s...", target.Id)
+	defer func() { s.Abort() }()
+
+	upstream, netName, err := rm.resolveTarget(ctx, cli, target)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Update("Routing %s to deployment %s (%s)...", rm.url(), target.Id, upstream)
+	proxy, err := rm.proxy(ctx, log, cli, src.App, job.Workspace, netName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := proxy.route(ctx, netName, upstream, target.Id); err != nil {
+		return nil, err
+	}
+	s.Update("Release %s routed to deployment %s", rm.url(), target.Id)
+	s.Done()
+
+	return &Release{
+		Url:          rm.url(),
+		DeploymentId: target.Id,
+		ProxyId:      proxy.id,
+		ProxyName:    proxy.name,
+		Target:       upstream,
+	}, nil
+}
+
+// A DestroyFunc removes the proxy container, but only when the release being
+// destroyed is the one the proxy currently routes to. Destroying an older
+// release must not take down the newer one.
+func (rm *ReleaseManager) destroy(
+	ctx context.Context,
+	log hclog.Logger,
+	ui terminal.UI,
+	release *Release,
+) error {
+	sg := ui.StepGroup()
+	defer sg.Wait()
+
+	if release.ProxyId == "" {
+		return nil
+	}
+
+	cli, err := platform.NewDockerClient(ctx, rm.config.ClientConfig)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to create Docker client: %s", err)
+	}
+
+	current, err := routedDeployment(ctx, cli, release.ProxyId)
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if current != release.DeploymentId {
+		log.Debug("proxy routes to a newer release, leaving it in place",
+			"proxy", release.ProxyName, "deployment", current)
+		return nil
+	}
+
+	s := sg.Add("Deleting release proxy: %s", release.ProxyName)
+	defer func() { s.Abort() }()
+
+	if err := removeProxy(ctx, cli, release.ProxyId); err != nil {
+		return err
+	}
+
+	s.Done()
+	return nil
+}
+
+func (rm *ReleaseManager) setDefaults() {
+	if rm.config.Port == 0 {
+		rm.config.Port = 8080
+	}
+	if rm.config.Hostname == "" {
+		rm.config.Hostname = "localhost"
+	}
+	if rm.config.Protocol == "" {
+		rm.config.Protocol = protocolHTTP
+	}
+	if rm.config.Image == "" {
+		rm.config.Image = defaultProxyImage
+	}
+}
+
+func (rm *ReleaseManager) url() string {
+	if rm.config.Protocol == protocolHTTP && rm.config.Port == 80 {
+		return fmt.Sprintf("http://%s", rm.config.Hostname)
+	}
+	return fmt.Sprintf("%s://%s:%d", rm.config.Protocol, rm.config.Hostname, rm.config.Port)
+}
+
+// resolveTarget returns the upstream address (name:port) of the deployment's
+// container and the name of the network it is reachable on. The upstream
+// uses the container name rather than its IP address, since the address can
+// change when docker restarts the container; the proxy resolves the name
+// through docker's embedded DNS server on every lookup instead.
+func (rm *ReleaseManager) resolveTarget(
+	ctx context.Context,
+	cli *client.Client,
+	target *docker.Deployment,
+) (string, string, error) {
+	info, err := cli.ContainerInspect(ctx, target.Container)
+	if err != nil {
+		return "", "", status.Errorf(codes.FailedPrecondition,
+			"unable to inspect container for deployment %q: %s", target.Id, err)
+	}
+	if info.State == nil || !info.State.Running {
+		return "", "", status.Errorf(codes.FailedPrecondition,
+			"container for deployment %q is not running", target.Id)
+	}
+
+	port := fmt.Sprint(rm.config.TargetPort)
+	if rm.config.TargetPort == 0 {
+		port = platform.ContainerServicePort(info)
+		if port == "" {
+			return "", "", status.Errorf(codes.FailedPrecondition,
+				"unable to determine the service port of deployment %q, set target_port", target.Id)
+		}
+	}
+
+	host := strings.TrimPrefix(info.Name, "/")
+	if info.NetworkSettings != nil {
+		// Pick networks in a stable order so repeated releases use the same one
+		names := make([]string, 0, len(info.NetworkSettings.Networks))
+		for name := range info.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, n := range names {
+			// Only user defined networks have the embedded DNS server
+			// that resolves container names.
+			if n == "bridge" || n == "host" || n == "none" {
+				continue
+			}
+			return host + ":" + port, n, nil
+		}
+	}
+
+	return "", "", status.Errorf(codes.FailedPrecondition,
+		"container for deployment %q is not attached to a user defined network", target.Id)
+}